@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultAblateOptions are the options ablated when -ablate-options is empty
+const DefaultAblateOptions = "temperature,top_k,top_p,repeat_penalty,presence_penalty"
+
+// Metrics an ablation measures. Score is only defined for graded prompts.
+const (
+	MetricScore   = "score"
+	MetricWords   = "words"
+	MetricLatency = "latency"
+)
+
+var ablationMetrics = []string{MetricScore, MetricWords, MetricLatency}
+
+// AblatedOption is an option and the values it is perturbed to
+type AblatedOption struct {
+	Spec   OptionSpec
+	Values []interface{}
+}
+
+// ParseAblatedOptions parses a comma-separated list of options, each with
+// its catalog sweep or explicit values, e.g. "temperature=0|0.5|1,top_p".
+func ParseAblatedOptions(text string) ([]AblatedOption, error) {
+	var options []AblatedOption
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, values, explicit := strings.Cut(item, "=")
+		spec, ok := LookupOption(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown option %s", name)
+		}
+		if spec.Type == OptionStrings {
+			return nil, fmt.Errorf("%s cannot be ablated", spec.Name)
+		}
+
+		option := AblatedOption{Spec: spec}
+		if explicit {
+			for _, text := range strings.Split(values, "|") {
+				value, err := spec.ParseValue(strings.TrimSpace(text))
+				if err != nil {
+					return nil, err
+				}
+				option.Values = append(option.Values, value)
+			}
+		} else {
+			option.Values = spec.Sweep
+		}
+		if len(option.Values) == 0 {
+			return nil, fmt.Errorf("%s has no sweep values; give them as %s=a|b|c", spec.Name, spec.Name)
+		}
+		for i, value := range option.Values {
+			v, err := spec.Check(value)
+			if err != nil {
+				return nil, err
+			}
+			option.Values[i] = v
+		}
+		options = append(options, option)
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("no options to ablate")
+	}
+	return options, nil
+}
+
+// AblationLevel is one value of an ablated option, with the mean of each
+// metric over the runs of its config
+type AblationLevel struct {
+	Value    interface{}        `json:"value"`
+	Config   ConfigKey          `json:"config"`
+	Baseline bool               `json:"baseline"`
+	Runs     int                `json:"runs"`
+	Means    map[string]float64 `json:"means"`
+}
+
+// AblationEffect is the effect of one option on one metric. Range is the
+// spread of the level means and EtaSquared the share of the option's own
+// variance explained by its levels. Share attributes the variance of the
+// whole ablation: the option's between-level sum of squares over the sum of
+// every option's plus the within-config (noise) sum of squares.
+type AblationEffect struct {
+	Range      float64 `json:"range"`
+	EtaSquared float64 `json:"etaSquared"`
+	Share      float64 `json:"share"`
+}
+
+// OptionSensitivity reports the levels of one option and its effects
+type OptionSensitivity struct {
+	Option  string                     `json:"option"`
+	Levels  []AblationLevel            `json:"levels"`
+	Effects map[string]*AblationEffect `json:"effects"`
+}
+
+// AblationReport is the sensitivity of one pattern to the options of a
+// preset. Noise is the share of variance left within configs.
+type AblationReport struct {
+	Pattern   string              `json:"pattern"`
+	Base      ConfigKey           `json:"base"`
+	Model     string              `json:"model"`
+	Prompts   []PromptKey         `json:"prompts"`
+	Options   []OptionSensitivity `json:"options"`
+	Noise     map[string]float64  `json:"noise"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// AblationVariant is the config a level of an option runs with
+type AblationVariant struct {
+	Option string
+	Value  interface{}
+	Config ConfigKey
+}
+
+// AblationVariants registers one preset per option value, named like
+// "Analytical[temperature=0.4]", holding every other option of the base
+// fixed. Values equal to the base are left out: they reuse its runs.
+func AblationVariants(base ConfigKey, options []AblatedOption) ([]AblationVariant, error) {
+	config, ok := Configs[base]
+	if !ok {
+		return nil, fmt.Errorf("unknown config %s", base)
+	}
+	resolved := ResolveOptions(config)
+
+	var variants []AblationVariant
+	for _, option := range options {
+		for _, value := range option.Values {
+			if current, ok := resolved[option.Spec.Name]; ok && current == value {
+				continue
+			}
+			key := ConfigKey(fmt.Sprintf("%s[%s=%s]", base, option.Spec.Name, formatOption(value)))
+			variant := make(map[string]interface{}, len(config)+1)
+			for k, v := range config {
+				variant[k] = v
+			}
+			setOption(variant, option.Spec.Name, value)
+			Configs[key] = variant
+			variants = append(variants, AblationVariant{Option: option.Spec.Name, Value: value, Config: key})
+		}
+	}
+	return variants, nil
+}
+
+// RunAblation runs the base preset and every variant on the prompts of a
+// pattern and reports the sensitivity of each metric to each option. Use
+// -trials above 1 so the noise within a config can be told apart from the
+// effects.
+func RunAblation(opts RunOptions, name string, prompts []PromptKey, base ConfigKey, options []AblatedOption) (*AblationReport, error) {
+	variants, err := AblationVariants(base, options)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []ConfigKey{base}
+	for _, v := range variants {
+		configs = append(configs, v.Config)
+	}
+	fmt.Printf("\nAblating %s on %s: %d configs x %d prompts\n", base, name, len(configs), len(prompts))
+	results, err := RunTestPattern(opts, CustomTest(prompts, configs))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AblationReport{
+		Pattern:   name,
+		Base:      base,
+		Model:     opts.Model,
+		Prompts:   prompts,
+		Noise:     make(map[string]float64),
+		Timestamp: time.Now(),
+	}
+
+	// Values are centered on the mean of their prompt, so differences
+	// between prompts do not count as noise
+	values := make(map[string]map[ConfigKey][]float64)
+	for _, metric := range ablationMetrics {
+		values[metric] = centeredMetric(results, metric)
+	}
+
+	resolved := ResolveOptions(Configs[base])
+	for _, option := range options {
+		s := OptionSensitivity{Option: option.Spec.Name, Effects: make(map[string]*AblationEffect)}
+		levels := []AblationLevel{{Value: resolved[option.Spec.Name], Config: base, Baseline: true}}
+		for _, v := range variants {
+			if v.Option == option.Spec.Name {
+				levels = append(levels, AblationLevel{Value: v.Value, Config: v.Config})
+			}
+		}
+		for i := range levels {
+			levels[i].Means = make(map[string]float64)
+			for _, result := range results {
+				if result.Config == levels[i].Config {
+					levels[i].Runs++
+				}
+			}
+			for _, metric := range ablationMetrics {
+				if raw := rawMetric(results, levels[i].Config, metric); len(raw) > 0 {
+					levels[i].Means[metric] = mean(raw)
+				}
+			}
+		}
+		s.Levels = levels
+		report.Options = append(report.Options, s)
+	}
+
+	for _, metric := range ablationMetrics {
+		byConfig := values[metric]
+		if len(byConfig) == 0 {
+			continue
+		}
+
+		var within float64
+		for _, v := range byConfig {
+			within += sumSquares(v, mean(v))
+		}
+
+		between := make([]float64, len(report.Options))
+		var total float64
+		for i := range report.Options {
+			s := &report.Options[i]
+			var groups [][]float64
+			for _, level := range s.Levels {
+				if v := byConfig[level.Config]; len(v) > 0 {
+					groups = append(groups, v)
+				}
+			}
+			if len(groups) < 2 {
+				continue
+			}
+
+			var all []float64
+			lo, hi := mean(groups[0]), mean(groups[0])
+			for _, g := range groups {
+				all = append(all, g...)
+				lo, hi = min(lo, mean(g)), max(hi, mean(g))
+			}
+			grand := mean(all)
+			for _, g := range groups {
+				between[i] += float64(len(g)) * (mean(g) - grand) * (mean(g) - grand)
+			}
+
+			effect := &AblationEffect{Range: hi - lo}
+			if ss := sumSquares(all, grand); ss > 0 {
+				effect.EtaSquared = between[i] / ss
+			}
+			s.Effects[metric] = effect
+			total += between[i]
+		}
+
+		total += within
+		if total == 0 {
+			continue
+		}
+		for i := range report.Options {
+			if effect, ok := report.Options[i].Effects[metric]; ok {
+				effect.Share = between[i] / total
+			}
+		}
+		report.Noise[metric] = within / total
+	}
+
+	return report, nil
+}
+
+// metricValue returns a metric of a result, or false when it is undefined
+func metricValue(result TestResult, metric string) (float64, bool) {
+	switch metric {
+	case MetricScore:
+		if result.Grade == nil {
+			return 0, false
+		}
+		return result.Grade.Score, true
+	case MetricWords:
+		return float64(result.Metrics.WordCount), true
+	case MetricLatency:
+		return result.Metrics.ResponseTime.Seconds(), true
+	}
+	return 0, false
+}
+
+// rawMetric collects a metric over the runs of a config
+func rawMetric(results []TestResult, config ConfigKey, metric string) []float64 {
+	var values []float64
+	for _, result := range results {
+		if result.Config != config {
+			continue
+		}
+		if v, ok := metricValue(result, metric); ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// centeredMetric collects a metric per config, minus the mean of the
+// metric over every run of the same prompt
+func centeredMetric(results []TestResult, metric string) map[ConfigKey][]float64 {
+	byPrompt := make(map[PromptKey][]float64)
+	for _, result := range results {
+		if v, ok := metricValue(result, metric); ok {
+			byPrompt[result.Prompt] = append(byPrompt[result.Prompt], v)
+		}
+	}
+
+	byConfig := make(map[ConfigKey][]float64)
+	for _, result := range results {
+		if v, ok := metricValue(result, metric); ok {
+			byConfig[result.Config] = append(byConfig[result.Config], v-mean(byPrompt[result.Prompt]))
+		}
+	}
+	return byConfig
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func sumSquares(values []float64, center float64) float64 {
+	var ss float64
+	for _, v := range values {
+		ss += (v - center) * (v - center)
+	}
+	return ss
+}
+
+// printAblationReport prints the level means of every option, then the
+// effect of each option on each metric: the range of its level means and
+// its share of the variance.
+func printAblationReport(report *AblationReport) {
+	fmt.Printf("\nAblation of %s on %s (%s, %d prompts):\n", report.Base, report.Pattern, report.Model, len(report.Prompts))
+	fmt.Printf("%-20s %10s %6s %8s %8s %10s\n", "Option", "Value", "Runs", "Score", "Words", "Latency")
+	for _, s := range report.Options {
+		for _, level := range s.Levels {
+			value := "default"
+			if level.Value != nil {
+				value = formatOption(level.Value)
+			}
+			if level.Baseline {
+				value += "*"
+			}
+			fmt.Printf("%-20s %10s %6d %8s %8s %10s\n", s.Option, value, level.Runs,
+				formatMean(level.Means, MetricScore, "%.2f"), formatMean(level.Means, MetricWords, "%.0f"),
+				formatMean(level.Means, MetricLatency, "%.2fs"))
+		}
+	}
+	fmt.Printf("* base value\n")
+
+	fmt.Printf("\nSensitivity (range of level means, share of variance):\n")
+	fmt.Printf("%-20s %16s %16s %16s\n", "Option", "Score", "Words", "Latency")
+	for _, s := range report.Options {
+		fmt.Printf("%-20s %16s %16s %16s\n", s.Option,
+			formatEffect(s.Effects[MetricScore], "%.2f"), formatEffect(s.Effects[MetricWords], "%.0f"),
+			formatEffect(s.Effects[MetricLatency], "%.2fs"))
+	}
+	fmt.Printf("%-20s %16s %16s %16s\n", "(noise)",
+		formatShare(report.Noise, MetricScore), formatShare(report.Noise, MetricWords), formatShare(report.Noise, MetricLatency))
+}
+
+func formatMean(means map[string]float64, metric, format string) string {
+	v, ok := means[metric]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf(format, v)
+}
+
+func formatEffect(effect *AblationEffect, format string) string {
+	if effect == nil {
+		return "-"
+	}
+	return fmt.Sprintf(format+" (%3.0f%%)", effect.Range, 100*effect.Share)
+}
+
+func formatShare(shares map[string]float64, metric string) string {
+	v, ok := shares[metric]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("(%3.0f%%)", 100*v)
+}
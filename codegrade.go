@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Code grader verdicts
+const (
+	VerdictNoCode       = "no_code"
+	VerdictCompileError = "compile_error"
+	VerdictVetError     = "vet_error"
+	VerdictTestsFailed  = "tests_failed"
+	VerdictTimeout      = "timeout"
+)
+
+// defaultCodeTimeout bounds each go build/vet/test step
+const defaultCodeTimeout = 30 * time.Second
+
+// Hard limits of the process running the hidden tests. The Go runtime
+// reserves about 700 MiB of address space at start, so 1 GiB leaves the
+// code under test roughly 256 MiB of heap.
+const (
+	codeAddressSpace = 1 << 30
+	codeProcesses    = 64
+)
+
+// CodeGrader compiles the Go code of a response in a scratch module next to
+// hidden tests and scores it by the fraction of tests passing.
+type CodeGrader struct {
+	// Tests is the content of the hidden solution_test.go (package solution)
+	Tests string
+	// Timeout bounds each toolchain step (default 30s)
+	Timeout time.Duration
+}
+
+func (g CodeGrader) Name() string { return "go-test" }
+
+var (
+	fencedGo      = regexp.MustCompile("(?s)```(?:go|golang)\\s*\\n(.*?)```")
+	fencedAny     = regexp.MustCompile("(?s)```[a-zA-Z]*\\s*\\n(.*?)```")
+	packageClause = regexp.MustCompile(`(?m)^package\s+\w+\s*$`)
+	testFunc      = regexp.MustCompile(`(?m)^func (Test\w+)\(t \*testing\.T\)`)
+)
+
+// ExtractGoCode returns the first Go code block of a response, falling back
+// to any fenced block.
+func ExtractGoCode(response string) string {
+	if match := fencedGo.FindStringSubmatch(response); match != nil {
+		return match[1]
+	}
+	if match := fencedAny.FindStringSubmatch(response); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (g CodeGrader) Grade(response string) *Grade {
+	grade := &Grade{Grader: g.Name()}
+
+	code := ExtractGoCode(response)
+	if strings.TrimSpace(code) == "" {
+		grade.Verdict = VerdictNoCode
+		grade.Details = "no fenced code block found in the response"
+		return grade
+	}
+
+	// The hidden tests live in package solution, whatever the model chose
+	if packageClause.MatchString(code) {
+		code = packageClause.ReplaceAllString(code, "package solution")
+	} else {
+		code = "package solution\n\n" + code
+	}
+
+	dir, err := os.MkdirTemp("", "slm-code-*")
+	if err != nil {
+		grade.Verdict = VerdictCompileError
+		grade.Details = "failed to create scratch module: " + err.Error()
+		return grade
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":           "module solution\n\ngo 1.21\n",
+		"solution.go":      code,
+		"solution_test.go": g.Tests,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			grade.Verdict = VerdictCompileError
+			grade.Details = "failed to write scratch module: " + err.Error()
+			return grade
+		}
+	}
+
+	// Count declared tests so a panic that stops the run still counts the
+	// tests it skipped as failures.
+	grade.Total = len(testFunc.FindAllString(g.Tests, -1))
+
+	timeout := g.Timeout
+	if timeout == 0 {
+		timeout = defaultCodeTimeout
+	}
+
+	// Compile both the solution and the tests into a test binary, so a
+	// wrong signature is a compile error rather than a test failure.
+	if out, err := runGo(dir, timeout, "test", "-c", "-o", testBinary, "."); err != nil {
+		grade.Verdict = VerdictCompileError
+		if err == context.DeadlineExceeded {
+			grade.Verdict = VerdictTimeout
+		}
+		grade.Errors = toolchainErrors(out)
+		grade.Details = fmt.Sprintf("%d compile errors", len(grade.Errors))
+		return grade
+	}
+
+	vetOut, vetErr := runGo(dir, timeout, "vet", ".")
+	if vetErr != nil {
+		grade.Errors = toolchainErrors(vetOut)
+	}
+
+	out, err := runLimited(dir, timeout, filepath.Join(dir, testBinary),
+		"-test.v=test2json", "-test.count=1", fmt.Sprintf("-test.timeout=%s", timeout))
+	if err == context.DeadlineExceeded {
+		grade.Verdict = VerdictTimeout
+		grade.Details = "tests did not finish within " + timeout.String()
+		return grade
+	}
+
+	grade.Passes = countPassedTests(testEvents(dir, out))
+	if grade.Total > 0 {
+		grade.Score = float64(grade.Passes) / float64(grade.Total)
+	}
+
+	switch {
+	case grade.Total == 0 || grade.Passes < grade.Total:
+		grade.Verdict = VerdictTestsFailed
+	case vetErr != nil:
+		grade.Verdict = VerdictVetError
+	default:
+		grade.Verdict = VerdictCorrect
+		grade.Passed = true
+	}
+	grade.Details = fmt.Sprintf("%d/%d tests passed", grade.Passes, grade.Total)
+	if vetErr != nil {
+		grade.Details += fmt.Sprintf(", %d vet issues", len(grade.Errors))
+	}
+
+	return grade
+}
+
+// runGo runs the go tool in dir with a deadline. It only builds and vets
+// code; the tests run through runLimited.
+func runGo(dir string, timeout time.Duration, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GOFLAGS=-mod=mod",
+		"GOPROXY=off",
+		"GOTOOLCHAIN=local",
+		"CGO_ENABLED=0",
+		"GOMAXPROCS=1",
+		"GOMEMLIMIT=256MiB",
+	)
+	cmd.WaitDelay = time.Second
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), context.DeadlineExceeded
+	}
+	return out.Bytes(), err
+}
+
+// testBinary is the name of the compiled hidden tests in the scratch module
+var testBinary = "solution.test"
+
+func init() {
+	if runtime.GOOS == "windows" {
+		testBinary += ".exe"
+	}
+}
+
+// runLimited runs a compiled test binary with a deadline and hard limits:
+// codeAddressSpace bytes of address space, the timeout in CPU seconds and
+// codeProcesses processes, set with prlimit. Where unprivileged user
+// namespaces work, it runs in one with no network (unshare -rn), which also
+// makes the process limit count only its own processes. Without prlimit,
+// the limits fall back to ulimit, and the process limit is left out since
+// it would count every process of the user.
+func runLimited(dir string, timeout time.Duration, binary string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cpu := int(timeout.Seconds()) + 1
+	isolated := networkIsolation()
+	var argv []string
+	if _, err := exec.LookPath("prlimit"); err == nil {
+		argv = []string{"prlimit", fmt.Sprintf("--as=%d", codeAddressSpace), fmt.Sprintf("--cpu=%d", cpu)}
+		if isolated {
+			argv = append(argv, fmt.Sprintf("--nproc=%d", codeProcesses))
+		}
+		argv = append(argv, "--")
+	} else if _, err := exec.LookPath("sh"); err == nil {
+		argv = []string{"sh", "-c", fmt.Sprintf(`ulimit -t %d; ulimit -v %d 2>/dev/null; exec "$0" "$@"`, cpu, codeAddressSpace>>10)}
+	}
+	if isolated {
+		argv = append([]string{"unshare", "-rn"}, argv...)
+	}
+	argv = append(append(argv, binary), args...)
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOMAXPROCS=1", "GOMEMLIMIT=256MiB")
+	cmd.WaitDelay = time.Second
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out.Bytes(), context.DeadlineExceeded
+	}
+	return out.Bytes(), err
+}
+
+var (
+	isolationOnce sync.Once
+	isolationOK   bool
+)
+
+// networkIsolation reports whether unshare can run a command in a new user
+// and network namespace, checked once
+func networkIsolation() bool {
+	isolationOnce.Do(func() {
+		isolationOK = exec.Command("unshare", "-rn", "true").Run() == nil
+	})
+	return isolationOK
+}
+
+// testEvents converts the output of a test binary run with
+// -test.v=test2json into go test -json events
+func testEvents(dir string, out []byte) []byte {
+	cmd := exec.Command("go", "tool", "test2json")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOTOOLCHAIN=local")
+	cmd.Stdin = bytes.NewReader(out)
+	events, _ := cmd.Output()
+	return events
+}
+
+// toolchainErrors keeps the file:line diagnostics of go build/vet output
+func toolchainErrors(out []byte) []string {
+	var errors []string
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, ".go:") {
+			errors = append(errors, line)
+		}
+	}
+	if len(errors) == 0 && len(bytes.TrimSpace(out)) > 0 {
+		errors = append(errors, strings.TrimSpace(string(out)))
+	}
+	return errors
+}
+
+// countPassedTests counts passing top-level tests in go test -json output
+func countPassedTests(out []byte) (passed int) {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var event struct {
+			Action string
+			Test   string
+		}
+		if json.Unmarshal(scanner.Bytes(), &event) != nil || event.Test == "" || strings.Contains(event.Test, "/") {
+			continue
+		}
+		if event.Action == "pass" {
+			passed++
+		}
+	}
+	return passed
+}
@@ -0,0 +1,114 @@
+package main
+
+// Hidden tests for the code-generation prompts. They are written to a scratch
+// module as solution_test.go and never shown to the model.
+
+const reverseWordsTests = `package solution
+
+import "testing"
+
+func TestReverseWordsBasic(t *testing.T) {
+	if got := ReverseWords("hello brave new world"); got != "world new brave hello" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReverseWordsSingle(t *testing.T) {
+	if got := ReverseWords("gopher"); got != "gopher" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReverseWordsExtraSpaces(t *testing.T) {
+	if got := ReverseWords("  the   sky  is blue "); got != "blue is sky the" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReverseWordsEmpty(t *testing.T) {
+	if got := ReverseWords("   "); got != "" {
+		t.Errorf("got %q", got)
+	}
+}
+`
+
+const isPalindromeTests = `package solution
+
+import "testing"
+
+func TestIsPalindromeSimple(t *testing.T) {
+	if !IsPalindrome("racecar") {
+		t.Error("racecar should be a palindrome")
+	}
+}
+
+func TestIsPalindromeIgnoresCaseAndPunctuation(t *testing.T) {
+	if !IsPalindrome("A man, a plan, a canal: Panama") {
+		t.Error("expected true")
+	}
+}
+
+func TestIsPalindromeRejects(t *testing.T) {
+	if IsPalindrome("gopher") {
+		t.Error("gopher is not a palindrome")
+	}
+}
+
+func TestIsPalindromeUnicode(t *testing.T) {
+	if !IsPalindrome("ΝΙΨΟΝ ΑΝΟΜΗΜΑΤΑ ΜΗ ΜΟΝΑΝ ΟΨΙΝ") {
+		t.Error("expected true for Greek input read rune by rune")
+	}
+}
+
+func TestIsPalindromeEmpty(t *testing.T) {
+	if !IsPalindrome("") {
+		t.Error("the empty string is a palindrome")
+	}
+}
+`
+
+const mergeIntervalsTests = `package solution
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeIntervalsOverlapping(t *testing.T) {
+	got := MergeIntervals([][2]int{{1, 3}, {2, 6}, {8, 10}, {15, 18}})
+	want := [][2]int{{1, 6}, {8, 10}, {15, 18}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeIntervalsTouching(t *testing.T) {
+	got := MergeIntervals([][2]int{{1, 4}, {4, 5}})
+	want := [][2]int{{1, 5}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeIntervalsUnsorted(t *testing.T) {
+	got := MergeIntervals([][2]int{{8, 10}, {1, 3}, {2, 4}})
+	want := [][2]int{{1, 4}, {8, 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeIntervalsContained(t *testing.T) {
+	got := MergeIntervals([][2]int{{1, 10}, {2, 3}, {4, 5}})
+	want := [][2]int{{1, 10}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestMergeIntervalsEmpty(t *testing.T) {
+	if got := MergeIntervals(nil); len(got) != 0 {
+		t.Errorf("got %v, want empty", got)
+	}
+}
+`
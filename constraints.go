@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Constraint is a verifiable instruction a response must follow, such as a
+// required opening or a paragraph count. Constraints are declared on a
+// prompt spec and checked independently of its grader.
+type Constraint interface {
+	// Name identifies the kind of constraint in summaries
+	Name() string
+	// Check reports whether the response follows the constraint, with
+	// details on what was found
+	Check(response string) (bool, string)
+}
+
+// ConstraintResult is the outcome of one constraint on one response
+type ConstraintResult struct {
+	Constraint string `json:"constraint"`
+	Passed     bool   `json:"passed"`
+	Details    string `json:"details,omitempty"`
+}
+
+// CheckConstraints runs every constraint of a prompt on a response
+func CheckConstraints(constraints []Constraint, response string) []ConstraintResult {
+	results := make([]ConstraintResult, 0, len(constraints))
+	for _, constraint := range constraints {
+		passed, details := constraint.Check(response)
+		results = append(results, ConstraintResult{Constraint: constraint.Name(), Passed: passed, Details: details})
+	}
+	return results
+}
+
+// countRange checks n against an inclusive range; a zero Max means no
+// upper bound.
+func countRange(n, min, max int, unit string) (bool, string) {
+	details := fmt.Sprintf("%d %s", n, unit)
+	switch {
+	case n < min:
+		return false, fmt.Sprintf("%s, expected at least %d", details, min)
+	case max > 0 && n > max:
+		return false, fmt.Sprintf("%s, expected at most %d", details, max)
+	}
+	return true, details
+}
+
+// StartsWith requires the response to open with Text, ignoring case and
+// Markdown decoration such as a heading mark, bold or quotes.
+type StartsWith struct {
+	Text string
+}
+
+func (c StartsWith) Name() string { return "starts_with" }
+
+func (c StartsWith) Check(response string) (bool, string) {
+	opening := []rune(strings.TrimLeft(response, " \t\r\n#*_>\"'`"))
+	if n := len([]rune(c.Text)); len(opening) > n {
+		opening = opening[:n]
+	}
+	if strings.EqualFold(string(opening), c.Text) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("starts with %q", string(opening))
+}
+
+// Paragraphs returns the blocks of a response separated by blank lines,
+// leaving out headings: single lines starting with '#', fully in bold or
+// without terminal punctuation.
+func Paragraphs(response string) []string {
+	var paragraphs []string
+	for _, block := range regexp.MustCompile(`\n\s*\n`).Split(strings.TrimSpace(response), -1) {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		if !strings.Contains(block, "\n") && (strings.HasPrefix(block, "#") ||
+			(strings.HasPrefix(block, "**") && strings.HasSuffix(block, "**")) ||
+			!strings.ContainsAny(lastRune(strings.TrimRight(block, "*_\"'”’)")), ".!?:;。！？…")) {
+			continue
+		}
+		paragraphs = append(paragraphs, block)
+	}
+	return paragraphs
+}
+
+// lastRune returns the last character of s, or ""
+func lastRune(s string) string {
+	r, size := utf8.DecodeLastRuneInString(s)
+	if size == 0 {
+		return ""
+	}
+	return string(r)
+}
+
+// ParagraphCount requires between Min and Max paragraphs (Max 0: no limit).
+// A first paragraph that is just Title, such as the title a StartsWith
+// constraint asks for, is not counted.
+type ParagraphCount struct {
+	Min, Max int
+	Title    string
+}
+
+func (c ParagraphCount) Name() string { return "paragraph_count" }
+
+func (c ParagraphCount) Check(response string) (bool, string) {
+	paragraphs := Paragraphs(response)
+	if c.Title != "" && len(paragraphs) > 0 &&
+		strings.EqualFold(strings.Trim(paragraphs[0], " \t#*_>\"'`"), c.Title) {
+		paragraphs = paragraphs[1:]
+	}
+	return countRange(len(paragraphs), c.Min, c.Max, "paragraphs")
+}
+
+var bulletLine = regexp.MustCompile(`^\s*(?:[-*•+]|\d+[.)])\s+\S`)
+
+// BulletCount requires between Min and Max bullet or numbered list items
+type BulletCount struct {
+	Min, Max int
+}
+
+func (c BulletCount) Name() string { return "bullet_count" }
+
+func (c BulletCount) Check(response string) (bool, string) {
+	n := 0
+	for _, line := range strings.Split(response, "\n") {
+		if bulletLine.MatchString(line) {
+			n++
+		}
+	}
+	return countRange(n, c.Min, c.Max, "bullets")
+}
+
+// WordCount requires between Min and Max words (Max 0: no limit), counted
+// as in the response metrics so CJK text is not a single word.
+type WordCount struct {
+	Min, Max int
+}
+
+func (c WordCount) Name() string { return "word_count" }
+
+func (c WordCount) Check(response string) (bool, string) {
+	return countRange(len(Words(response)), c.Min, c.Max, "words")
+}
+
+// Language requires the response to be written mainly in a language, given
+// as an ISO 639-1 code.
+type Language struct {
+	Code string
+}
+
+func (c Language) Name() string { return "language" }
+
+func (c Language) Check(response string) (bool, string) {
+	report := AnalyzeLanguage(response)
+	return report.Main() == c.Code, report.String()
+}
+
+// ContainsLanguages requires a segment in each language, for answers that
+// must mix languages such as translations.
+type ContainsLanguages struct {
+	Codes []string
+}
+
+func (c ContainsLanguages) Name() string { return "contains_languages" }
+
+func (c ContainsLanguages) Check(response string) (bool, string) {
+	report := AnalyzeLanguage(response)
+	var missing []string
+	for _, code := range c.Codes {
+		if report.Share(code) == 0 {
+			missing = append(missing, code)
+		}
+	}
+	if len(missing) > 0 {
+		return false, "missing " + strings.Join(missing, ", ") + " (" + report.String() + ")"
+	}
+	return true, report.String()
+}
+
+// ContainsScripts requires letters in each Unicode script, or script alias
+// such as "Japanese" (kana or Han).
+type ContainsScripts struct {
+	Scripts []string
+}
+
+func (c ContainsScripts) Name() string { return "contains_scripts" }
+
+func (c ContainsScripts) Check(response string) (bool, string) {
+	report := AnalyzeLanguage(response)
+	var missing []string
+	for _, script := range c.Scripts {
+		if report.ScriptShare(script) == 0 {
+			missing = append(missing, script)
+		}
+	}
+	if len(missing) > 0 {
+		return false, "missing " + strings.Join(missing, ", ") + " script"
+	}
+	return true, report.String()
+}
+
+// NoCommas forbids commas, including the full-width and ideographic ones
+type NoCommas struct{}
+
+func (c NoCommas) Name() string { return "no_commas" }
+
+func (c NoCommas) Check(response string) (bool, string) {
+	n := strings.Count(response, ",") + strings.Count(response, "，") + strings.Count(response, "、")
+	if n > 0 {
+		return false, fmt.Sprintf("%d commas", n)
+	}
+	return true, ""
+}
+
+// IncludeKeywords requires every keyword to appear as a whole word
+type IncludeKeywords struct {
+	Keywords []string
+}
+
+func (c IncludeKeywords) Name() string { return "include_keywords" }
+
+func (c IncludeKeywords) Check(response string) (bool, string) {
+	var missing []string
+	for _, keyword := range c.Keywords {
+		if !containsWord(response, keyword) {
+			missing = append(missing, keyword)
+		}
+	}
+	if len(missing) > 0 {
+		return false, "missing " + strings.Join(missing, ", ")
+	}
+	return true, ""
+}
+
+// JSONOnly requires the whole response to be valid JSON, optionally
+// wrapped in a single code fence.
+type JSONOnly struct{}
+
+func (c JSONOnly) Name() string { return "json_only" }
+
+func (c JSONOnly) Check(response string) (bool, string) {
+	payload := strings.TrimSpace(response)
+	if strings.HasPrefix(payload, "```") && strings.HasSuffix(payload, "```") && len(payload) >= 6 {
+		payload = strings.TrimSpace(payload[3 : len(payload)-3])
+		payload = strings.TrimSpace(strings.TrimPrefix(payload, "json"))
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(payload), &value); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+// AllLowercase forbids uppercase letters
+type AllLowercase struct{}
+
+func (c AllLowercase) Name() string { return "all_lowercase" }
+
+func (c AllLowercase) Check(response string) (bool, string) {
+	var upper []rune
+	for _, r := range response {
+		if unicode.IsUpper(r) {
+			upper = append(upper, r)
+		}
+	}
+	if len(upper) > 0 {
+		return false, fmt.Sprintf("%d uppercase letters (%s)", len(upper), string(upper[:min(len(upper), 10)]))
+	}
+	return true, ""
+}
+
+// printConstraintSummary reports the pass rate of each kind of constraint
+// per config, and the share of responses that followed all of theirs.
+func printConstraintSummary(results []TestResult) {
+	type totals struct {
+		runs, passed int
+	}
+	byConstraint := make(map[string]map[string]*totals)
+	configs := make(map[string]bool)
+
+	add := func(constraint, config string, passed bool) {
+		if byConstraint[constraint] == nil {
+			byConstraint[constraint] = make(map[string]*totals)
+		}
+		t, ok := byConstraint[constraint][config]
+		if !ok {
+			t = &totals{}
+			byConstraint[constraint][config] = t
+		}
+		t.runs++
+		if passed {
+			t.passed++
+		}
+	}
+
+	for _, result := range results {
+		if len(result.Constraints) == 0 {
+			continue
+		}
+		config := string(result.Config)
+		configs[config] = true
+		all := true
+		for _, c := range result.Constraints {
+			add(c.Constraint, config, c.Passed)
+			all = all && c.Passed
+		}
+		add("(all, per prompt)", config, all)
+	}
+
+	if len(configs) == 0 {
+		return
+	}
+
+	columns := sortedKeys(configs)
+	fmt.Printf("\nInstruction-following summary:\n")
+	fmt.Printf("%-20s", "Constraint")
+	for _, config := range columns {
+		fmt.Printf(" %18s", config)
+	}
+	fmt.Println()
+	for _, constraint := range sortedKeys(byConstraint) {
+		fmt.Printf("%-20s", constraint)
+		for _, config := range columns {
+			t, ok := byConstraint[constraint][config]
+			if !ok {
+				fmt.Printf(" %18s", "-")
+				continue
+			}
+			fmt.Printf(" %18s", fmt.Sprintf("%d/%d (%.0f%%)", t.passed, t.runs, 100*float64(t.passed)/float64(t.runs)))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Degeneration thresholds. A response is degenerate when most of its word
+// 4-grams are repeats; the watchdog looks at the tail of a stream for an
+// exact loop or a window of repeated 4-grams.
+const (
+	degenerateNgram      = 4
+	degenerateRatio      = 0.5
+	degenerateMinWords   = 40
+	watchdogMinLoop      = 120 // runes spanned by the repeats of a loop
+	watchdogRepeats      = 3   // times a period must repeat to be a loop
+	watchdogMaxPeriod    = 400 // longest period in runes
+	watchdogWindowWords  = 100
+	watchdogWindowRatio  = 0.8
+	watchdogCheckEvery   = 64 // runes between two checks
+	longestRepeatMaxText = 20000
+)
+
+// Degeneration holds the repetition metrics of a response. Aborted is set
+// when the watchdog stopped a looping generation.
+type Degeneration struct {
+	RepeatedNgramRatio float64 `json:"repeatedNgramRatio"`
+	LongestRepeat      int     `json:"longestRepeat"`
+	CompressionRatio   float64 `json:"compressionRatio"`
+	Degenerate         bool    `json:"degenerate"`
+	Aborted            bool    `json:"aborted,omitempty"`
+	Reason             string  `json:"reason,omitempty"`
+}
+
+// AnalyzeDegeneration computes the repeated 4-gram ratio, the longest
+// substring occurring twice (in runes) and the deflate compression ratio of
+// a response; looping text scores high on all three.
+func AnalyzeDegeneration(text string) *Degeneration {
+	d := &Degeneration{
+		RepeatedNgramRatio: repeatedNgramRatio(Words(text), degenerateNgram),
+		CompressionRatio:   compressionRatio(text),
+	}
+	if runes := []rune(text); len(runes) <= longestRepeatMaxText {
+		d.LongestRepeat = longestRepeat(runes)
+	}
+	if len(Words(text)) >= degenerateMinWords && d.RepeatedNgramRatio >= degenerateRatio {
+		d.Degenerate = true
+		d.Reason = fmt.Sprintf("%.0f%% of %d-grams repeated", 100*d.RepeatedNgramRatio, degenerateNgram)
+	}
+	return d
+}
+
+// repeatedNgramRatio is the share of the n-grams of words that already
+// appeared earlier in the sequence.
+func repeatedNgramRatio(words []string, n int) float64 {
+	if len(words) < n {
+		return 0
+	}
+	seen := make(map[string]bool)
+	repeated := 0
+	for i := 0; i+n <= len(words); i++ {
+		gram := strings.ToLower(strings.Join(words[i:i+n], " "))
+		if seen[gram] {
+			repeated++
+		}
+		seen[gram] = true
+	}
+	return float64(repeated) / float64(len(words)-n+1)
+}
+
+// compressionRatio is the size of text over its deflated size
+func compressionRatio(text string) float64 {
+	if text == "" {
+		return 0
+	}
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	w.Write([]byte(text))
+	w.Close()
+	return float64(len(text)) / float64(buf.Len())
+}
+
+// longestRepeat returns the length of the longest substring occurring at
+// least twice, by binary search on the length with rolling hashes.
+func longestRepeat(runes []rune) int {
+	lo, hi := 0, len(runes)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if hasRepeat(runes, mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	return max(lo, 0)
+}
+
+// hasRepeat reports whether a substring of the given length occurs twice,
+// comparing the runes of hash collisions.
+func hasRepeat(runes []rune, length int) bool {
+	const base = 1000003
+	var hash, power uint64 = 0, 1
+	for i := 0; i < length; i++ {
+		hash = hash*base + uint64(runes[i])
+		power *= base
+	}
+
+	seen := map[uint64][]int{hash: {0}}
+	for start := 1; start+length <= len(runes); start++ {
+		hash = hash*base + uint64(runes[start+length-1]) - power*uint64(runes[start-1])
+		for _, other := range seen[hash] {
+			if string(runes[other:other+length]) == string(runes[start:start+length]) {
+				return true
+			}
+		}
+		seen[hash] = append(seen[hash], start)
+	}
+	return false
+}
+
+// Watchdog follows a streamed generation and detects when it starts
+// looping, so the request can be cancelled before num_predict is reached.
+type Watchdog struct {
+	text      []rune
+	lastCheck int
+	Reason    string
+}
+
+// Feed adds a streamed chunk and reports whether generation should go on
+func (w *Watchdog) Feed(chunk string) bool {
+	w.text = append(w.text, []rune(chunk)...)
+	if len(w.text)-w.lastCheck < watchdogCheckEvery {
+		return true
+	}
+	w.lastCheck = len(w.text)
+
+	if period := loopPeriod(w.text); period > 0 {
+		w.Reason = fmt.Sprintf("loop of %d characters repeated", period)
+		return false
+	}
+	words := Words(string(w.text[max(0, len(w.text)-20*watchdogWindowWords):]))
+	if len(words) >= watchdogWindowWords {
+		window := words[len(words)-watchdogWindowWords:]
+		if ratio := repeatedNgramRatio(window, degenerateNgram); ratio >= watchdogWindowRatio {
+			w.Reason = fmt.Sprintf("%.0f%% of the last %d words' %d-grams repeated", 100*ratio, watchdogWindowWords, degenerateNgram)
+			return false
+		}
+	}
+	return true
+}
+
+// loopPeriod returns the shortest period p such that the tail of text
+// repeats p-rune blocks at least watchdogRepeats times over at least
+// watchdogMinLoop runes, or 0. Blocks without a letter or digit are not
+// loops: they are rules ("-----", "= = ="), indentation or padding.
+func loopPeriod(text []rune) int {
+	for p := 1; p <= watchdogMaxPeriod; p++ {
+		span := max(p*watchdogRepeats, watchdogMinLoop)
+		if span > len(text) {
+			return 0
+		}
+		tail := text[len(text)-span:]
+		periodic := true
+		for i := p; i < len(tail); i++ {
+			if tail[i] != tail[i-p] {
+				periodic = false
+				break
+			}
+		}
+		if periodic && strings.ContainsFunc(string(tail[:p]), func(r rune) bool {
+			return unicode.IsLetter(r) || unicode.IsDigit(r)
+		}) {
+			return p
+		}
+	}
+	return 0
+}
+
+// printDegenerationSummary reports per config how many responses were
+// degenerate, how many the watchdog aborted, and the mean repetition.
+func printDegenerationSummary(results []TestResult) {
+	type totals struct {
+		runs, degenerate, aborted int
+		ratio, compression        float64
+	}
+	byConfig := make(map[string]*totals)
+	flagged := false
+	for _, result := range results {
+		d := result.Degeneration
+		if d == nil {
+			continue
+		}
+		config := string(result.Config)
+		t, ok := byConfig[config]
+		if !ok {
+			t = &totals{}
+			byConfig[config] = t
+		}
+		t.runs++
+		t.ratio += d.RepeatedNgramRatio
+		t.compression += d.CompressionRatio
+		if d.Degenerate {
+			t.degenerate++
+			flagged = true
+		}
+		if d.Aborted {
+			t.aborted++
+		}
+	}
+
+	if !flagged {
+		return
+	}
+
+	fmt.Printf("\nDegeneration summary:\n")
+	fmt.Printf("%-20s %6s %12s %8s %14s %12s\n", "Config", "Runs", "Degenerate", "Aborted", "Repeated 4-gr", "Compression")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		fmt.Printf("%-20s %6d %12s %8d %13.0f%% %11.1fx\n", config, t.runs,
+			fmt.Sprintf("%d (%.0f%%)", t.degenerate, 100*float64(t.degenerate)/float64(t.runs)),
+			t.aborted, 100*t.ratio/float64(t.runs), t.compression/float64(t.runs))
+	}
+}
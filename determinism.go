@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// DeterminismResult compares two runs of a cell with the same seed.
+// EditDistance is the Levenshtein distance over the longer response, and
+// Divergence the rune offset where the responses first differ (-1 when
+// they are identical).
+type DeterminismResult struct {
+	Cell         string    `json:"cell"`
+	Config       ConfigKey `json:"config"`
+	Prompt       PromptKey `json:"prompt"`
+	Model        string    `json:"model"`
+	URL          string    `json:"url"`
+	Seed         int64     `json:"seed"`
+	Identical    bool      `json:"identical"`
+	EditDistance float64   `json:"editDistance"`
+	Divergence   int       `json:"divergence"`
+	Responses    [2]string `json:"responses"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// RunDeterminism runs every cell of a pattern twice with the same sampling
+// seed, and compares the two responses of each cell.
+func RunDeterminism(opts RunOptions, pattern TestPattern) []DeterminismResult {
+	opts.Trials = 2
+	opts.SeedSampling = true
+	opts.SameSampleSeed = true
+
+	results, _ := RunTestPattern(opts, pattern)
+
+	var checks []DeterminismResult
+	keys, cells := groupCells(results)
+	for _, key := range keys {
+		runs := cells[key]
+		if len(runs) != 2 {
+			fmt.Printf("Skipping %s: %d of 2 runs succeeded\n", key, len(runs))
+			continue
+		}
+
+		a, b := runs[0].Response, runs[1].Response
+		checks = append(checks, DeterminismResult{
+			Cell:         key,
+			Config:       runs[0].Config,
+			Prompt:       runs[0].Prompt,
+			Model:        opts.Model,
+			URL:          opts.URL,
+			Seed:         opts.SampleSeed,
+			Identical:    a == b,
+			EditDistance: 1 - EditSimilarity(a, b),
+			Divergence:   divergence(a, b),
+			Responses:    [2]string{a, b},
+			Timestamp:    runs[1].Timestamp,
+		})
+	}
+	return checks
+}
+
+// divergence returns the offset in runes of the first difference between
+// a and b, or -1 when they are equal.
+func divergence(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	for i := 0; i < min(len(ra), len(rb)); i++ {
+		if ra[i] != rb[i] {
+			return i
+		}
+	}
+	if len(ra) == len(rb) {
+		return -1
+	}
+	return min(len(ra), len(rb))
+}
+
+// printDeterminismSummary reports per config how many cells reproduced
+// byte-identical output, and how far apart the others were.
+func printDeterminismSummary(checks []DeterminismResult) {
+	if len(checks) == 0 {
+		return
+	}
+
+	type totals struct {
+		cells, identical      int
+		distance, maxDistance float64
+	}
+	byConfig := make(map[string]*totals)
+	for _, c := range checks {
+		config := string(c.Config)
+		t, ok := byConfig[config]
+		if !ok {
+			t = &totals{}
+			byConfig[config] = t
+		}
+		t.cells++
+		if c.Identical {
+			t.identical++
+		}
+		t.distance += c.EditDistance
+		t.maxDistance = max(t.maxDistance, c.EditDistance)
+	}
+
+	fmt.Printf("\nDeterminism summary (%s at %s, seed %d):\n", checks[0].Model, checks[0].URL, checks[0].Seed)
+	fmt.Printf("%-20s %6s %12s %14s %14s %14s\n", "Config", "Cells", "Identical", "Mean distance", "Max distance", "Reproducible")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		reproducible := "no"
+		if t.identical == t.cells {
+			reproducible = "yes"
+		}
+		fmt.Printf("%-20s %6d %12s %14.3f %14.3f %14s\n", config, t.cells,
+			fmt.Sprintf("%d/%d", t.identical, t.cells), t.distance/float64(t.cells), t.maxDistance, reproducible)
+	}
+
+	for _, c := range checks {
+		if !c.Identical {
+			fmt.Printf("- %s diverged at character %d (distance %.3f)\n", c.Cell, c.Divergence, c.EditDistance)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/parakeet-nest/parakeet/similarity"
+)
+
+// selfBLEUOrder is the highest n-gram order of self-BLEU
+const selfBLEUOrder = 4
+
+// CellKey identifies the cell a result was sampled in: its prompt, config,
+// retrieval settings and generated instance. Trials of one cell share it.
+func CellKey(result TestResult) string {
+	key := fmt.Sprintf("%s|%s", result.Prompt, result.Config)
+	if result.RAG != nil {
+		key += fmt.Sprintf("|chunk=%d,k=%d", result.RAG.ChunkSize, result.RAG.K)
+	}
+	if result.Instance != nil {
+		key += fmt.Sprintf("|#%d", result.Instance.Index)
+	}
+	return key
+}
+
+// groupCells groups results by cell, keeping the order cells first appear in
+func groupCells(results []TestResult) ([]string, map[string][]TestResult) {
+	var keys []string
+	cells := make(map[string][]TestResult)
+	for _, result := range results {
+		key := CellKey(result)
+		if _, ok := cells[key]; !ok {
+			keys = append(keys, key)
+		}
+		cells[key] = append(cells[key], result)
+	}
+	return keys, cells
+}
+
+// DiversityResult measures how different the samples of one cell are.
+// Distinct-n is the share of unique n-grams over all samples, self-BLEU the
+// mean BLEU of each sample against the others (high means repetitive), and
+// EmbeddingDistance the mean pairwise cosine distance of their embeddings.
+type DiversityResult struct {
+	Cell              string    `json:"cell"`
+	Config            ConfigKey `json:"config"`
+	Prompt            PromptKey `json:"prompt"`
+	Samples           int       `json:"samples"`
+	Distinct1         float64   `json:"distinct1"`
+	Distinct2         float64   `json:"distinct2"`
+	SelfBLEU          float64   `json:"selfBleu"`
+	EmbeddingDistance *float64  `json:"embeddingDistance,omitempty"`
+	UniqueResponses   int       `json:"uniqueResponses"`
+	MeanScore         *float64  `json:"meanScore,omitempty"`
+}
+
+// AnalyzeDiversity computes the diversity of every cell with more than one
+// sample. Embedding distances use embedModel, and are skipped when it is
+// empty or fails.
+func AnalyzeDiversity(url, embedModel string, results []TestResult) []DiversityResult {
+	var diversity []DiversityResult
+	keys, cells := groupCells(results)
+	for _, key := range keys {
+		samples := cells[key]
+		if len(samples) < 2 {
+			continue
+		}
+
+		d := DiversityResult{
+			Cell:    key,
+			Config:  samples[0].Config,
+			Prompt:  samples[0].Prompt,
+			Samples: len(samples),
+		}
+
+		tokens := make([][]string, len(samples))
+		responses := make([]string, len(samples))
+		unique := make(map[string]bool)
+		var score float64
+		graded := 0
+		for i, sample := range samples {
+			tokens[i] = Words(strings.ToLower(sample.Response))
+			responses[i] = sample.Response
+			unique[strings.Join(tokens[i], " ")] = true
+			if sample.Grade != nil {
+				score += sample.Grade.Score
+				graded++
+			}
+		}
+		d.Distinct1 = distinctN(tokens, 1)
+		d.Distinct2 = distinctN(tokens, 2)
+		d.SelfBLEU = selfBLEU(tokens)
+		d.UniqueResponses = len(unique)
+		if graded > 0 {
+			mean := score / float64(graded)
+			d.MeanScore = &mean
+		}
+
+		if embedModel != "" {
+			distance, err := embeddingDistance(url, embedModel, responses)
+			if err != nil {
+				fmt.Printf("Embedding error for %s: %v\n", key, err)
+			} else {
+				d.EmbeddingDistance = &distance
+			}
+		}
+
+		diversity = append(diversity, d)
+	}
+	return diversity
+}
+
+// ngrams returns the n-grams of tokens joined by spaces
+func ngrams(tokens []string, n int) []string {
+	var grams []string
+	for i := 0; i+n <= len(tokens); i++ {
+		grams = append(grams, strings.Join(tokens[i:i+n], " "))
+	}
+	return grams
+}
+
+// distinctN is the number of unique n-grams over the total n-grams of all
+// samples
+func distinctN(samples [][]string, n int) float64 {
+	unique := make(map[string]bool)
+	total := 0
+	for _, tokens := range samples {
+		for _, gram := range ngrams(tokens, n) {
+			unique[gram] = true
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(len(unique)) / float64(total)
+}
+
+// bleu scores a candidate against references with clipped n-gram precision
+// up to selfBLEUOrder, add-one smoothing above unigrams and the brevity
+// penalty of the closest reference length.
+func bleu(candidate []string, references [][]string) float64 {
+	if len(candidate) == 0 {
+		return 0
+	}
+
+	var logPrecision float64
+	for n := 1; n <= selfBLEUOrder; n++ {
+		maxCounts := make(map[string]int)
+		for _, reference := range references {
+			counts := make(map[string]int)
+			for _, gram := range ngrams(reference, n) {
+				counts[gram]++
+			}
+			for gram, c := range counts {
+				maxCounts[gram] = max(maxCounts[gram], c)
+			}
+		}
+
+		counts := make(map[string]int)
+		grams := ngrams(candidate, n)
+		for _, gram := range grams {
+			counts[gram]++
+		}
+		clipped := 0
+		for gram, c := range counts {
+			clipped += min(c, maxCounts[gram])
+		}
+
+		matches, total := float64(clipped), float64(len(grams))
+		if n > 1 {
+			matches, total = matches+1, total+1
+		}
+		if matches == 0 || total == 0 {
+			return 0
+		}
+		logPrecision += math.Log(matches/total) / selfBLEUOrder
+	}
+
+	closest := len(references[0])
+	for _, reference := range references[1:] {
+		if d, best := abs(len(reference)-len(candidate)), abs(closest-len(candidate)); d < best || (d == best && len(reference) < closest) {
+			closest = len(reference)
+		}
+	}
+	brevity := 1.0
+	if len(candidate) < closest {
+		brevity = math.Exp(1 - float64(closest)/float64(len(candidate)))
+	}
+
+	return brevity * math.Exp(logPrecision)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// selfBLEU is the mean BLEU of each sample against all the others
+func selfBLEU(samples [][]string) float64 {
+	var sum float64
+	for i, candidate := range samples {
+		var references [][]string
+		for j, reference := range samples {
+			if j != i {
+				references = append(references, reference)
+			}
+		}
+		sum += bleu(candidate, references)
+	}
+	return sum / float64(len(samples))
+}
+
+// embeddingDistance is the mean pairwise cosine distance of the embeddings
+// of the responses
+func embeddingDistance(url, model string, responses []string) (float64, error) {
+	answer, err := Embed(url, EmbedRequest{Model: model, Input: responses})
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	pairs := 0
+	for i := range answer.Embeddings {
+		for j := i + 1; j < len(answer.Embeddings); j++ {
+			sum += 1 - similarity.CosineDistance(answer.Embeddings[i], answer.Embeddings[j])
+			pairs++
+		}
+	}
+	return sum / float64(pairs), nil
+}
+
+// printDiversitySummary averages the diversity of each config's cells next
+// to their mean score, showing the diversity/quality trade-off.
+func printDiversitySummary(diversity []DiversityResult) {
+	if len(diversity) == 0 {
+		return
+	}
+
+	type totals struct {
+		cells, samples, unique     int
+		distinct1, distinct2, bleu float64
+		distance, score            float64
+		distances, scored          int
+	}
+	byConfig := make(map[string]*totals)
+	for _, d := range diversity {
+		config := string(d.Config)
+		t, ok := byConfig[config]
+		if !ok {
+			t = &totals{}
+			byConfig[config] = t
+		}
+		t.cells++
+		t.samples += d.Samples
+		t.unique += d.UniqueResponses
+		t.distinct1 += d.Distinct1
+		t.distinct2 += d.Distinct2
+		t.bleu += d.SelfBLEU
+		if d.EmbeddingDistance != nil {
+			t.distance += *d.EmbeddingDistance
+			t.distances++
+		}
+		if d.MeanScore != nil {
+			t.score += *d.MeanScore
+			t.scored++
+		}
+	}
+
+	fmt.Printf("\nDiversity summary (mean over cells):\n")
+	fmt.Printf("%-20s %6s %10s %10s %10s %10s %10s %8s\n", "Config", "Cells", "Distinct-1", "Distinct-2", "Self-BLEU", "Emb dist", "Unique", "Score")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		cells := float64(t.cells)
+		distance, score := "-", "-"
+		if t.distances > 0 {
+			distance = fmt.Sprintf("%.3f", t.distance/float64(t.distances))
+		}
+		if t.scored > 0 {
+			score = fmt.Sprintf("%.0f%%", 100*t.score/float64(t.scored))
+		}
+		fmt.Printf("%-20s %6d %10.3f %10.3f %10.3f %10s %10s %8s\n", config, t.cells,
+			t.distinct1/cells, t.distinct2/cells, t.bleu/cells, distance,
+			fmt.Sprintf("%d/%d", t.unique, t.samples), score)
+	}
+}
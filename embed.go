@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/similarity"
+)
+
+// embedBatchSize is the number of documents sent per /api/embed call
+const embedBatchSize = 16
+
+// EmbedDocument is a labeled document of an embedding corpus
+type EmbedDocument struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Text  string `json:"text"`
+}
+
+// EmbedQuery is a query and the IDs of the documents relevant to it
+type EmbedQuery struct {
+	Text     string   `json:"text"`
+	Relevant []string `json:"relevant"`
+}
+
+// EmbedCorpus is the labeled corpus and query set of the embed mode
+type EmbedCorpus struct {
+	Documents []EmbedDocument `json:"documents"`
+	Queries   []EmbedQuery    `json:"queries"`
+}
+
+// EmbedResult holds the retrieval, clustering and speed metrics of a model
+type EmbedResult struct {
+	Model      string        `json:"model"`
+	Dimensions int           `json:"dimensions"`
+	K          int           `json:"k"`
+	RecallAtK  float64       `json:"recallAtK"`
+	MRR        float64       `json:"mrr"`
+	NDCGAtK    float64       `json:"ndcgAtK"`
+	Silhouette float64       `json:"silhouette"`
+	QueryTime  time.Duration `json:"queryTime"`
+	DocsPerSec float64       `json:"docsPerSec"`
+	Timestamp  time.Time     `json:"timestamp"`
+}
+
+// LoadEmbedCorpus reads a corpus file and checks that every relevant ID exists
+func LoadEmbedCorpus(path string) (*EmbedCorpus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %v", err)
+	}
+
+	var corpus EmbedCorpus
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		return nil, fmt.Errorf("failed to parse corpus: %v", err)
+	}
+
+	ids := make(map[string]bool, len(corpus.Documents))
+	for _, doc := range corpus.Documents {
+		ids[doc.ID] = true
+	}
+	for _, query := range corpus.Queries {
+		for _, id := range query.Relevant {
+			if !ids[id] {
+				return nil, fmt.Errorf("query %q references unknown document %s", query.Text, id)
+			}
+		}
+	}
+
+	return &corpus, nil
+}
+
+// EvaluateEmbeddings embeds the corpus with model and scores retrieval of
+// the top k documents for every query.
+func EvaluateEmbeddings(url, model string, corpus *EmbedCorpus, k int) (EmbedResult, error) {
+	result := EmbedResult{Model: model, K: k}
+
+	// Documents are embedded in batches to measure throughput
+	texts := make([]string, len(corpus.Documents))
+	for i, doc := range corpus.Documents {
+		texts[i] = doc.Text
+	}
+
+	var docVectors [][]float64
+	start := time.Now()
+	for i := 0; i < len(texts); i += embedBatchSize {
+		answer, err := Embed(url, EmbedRequest{Model: model, Input: texts[i:min(i+embedBatchSize, len(texts))]})
+		if err != nil {
+			return EmbedResult{}, fmt.Errorf("embedding error: %v", err)
+		}
+		docVectors = append(docVectors, answer.Embeddings...)
+	}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		result.DocsPerSec = float64(len(texts)) / elapsed
+	}
+	if len(docVectors) > 0 {
+		result.Dimensions = len(docVectors[0])
+	}
+
+	// Queries are embedded one at a time to measure single-request latency
+	var totalQueryTime time.Duration
+	for _, query := range corpus.Queries {
+		start := time.Now()
+		answer, err := Embed(url, EmbedRequest{Model: model, Input: []string{query.Text}})
+		if err != nil {
+			return EmbedResult{}, fmt.Errorf("embedding error: %v", err)
+		}
+		totalQueryTime += time.Since(start)
+
+		ranking := rankDocuments(answer.Embeddings[0], docVectors)
+		relevant := make(map[string]bool, len(query.Relevant))
+		for _, id := range query.Relevant {
+			relevant[id] = true
+		}
+
+		var hits int
+		var dcg float64
+		firstHit := 0
+		for rank, index := range ranking {
+			if !relevant[corpus.Documents[index].ID] {
+				continue
+			}
+			if firstHit == 0 {
+				firstHit = rank + 1
+			}
+			if rank < k {
+				hits++
+				dcg += 1 / math.Log2(float64(rank+2))
+			}
+		}
+
+		var idcg float64
+		for rank := 0; rank < min(k, len(relevant)); rank++ {
+			idcg += 1 / math.Log2(float64(rank+2))
+		}
+
+		if len(relevant) > 0 {
+			result.RecallAtK += float64(hits) / float64(len(relevant))
+		}
+		if firstHit > 0 {
+			result.MRR += 1 / float64(firstHit)
+		}
+		if idcg > 0 {
+			result.NDCGAtK += dcg / idcg
+		}
+	}
+
+	if n := float64(len(corpus.Queries)); n > 0 {
+		result.RecallAtK /= n
+		result.MRR /= n
+		result.NDCGAtK /= n
+		result.QueryTime = totalQueryTime / time.Duration(len(corpus.Queries))
+	}
+
+	labels := make([]string, len(corpus.Documents))
+	for i, doc := range corpus.Documents {
+		labels[i] = doc.Label
+	}
+	result.Silhouette = silhouette(docVectors, labels)
+	result.Timestamp = time.Now()
+
+	return result, nil
+}
+
+// rankDocuments returns document indexes sorted by cosine similarity
+func rankDocuments(query []float64, docs [][]float64) []int {
+	scores := make([]float64, len(docs))
+	ranking := make([]int, len(docs))
+	for i, doc := range docs {
+		scores[i] = similarity.CosineDistance(query, doc)
+		ranking[i] = i
+	}
+	sort.SliceStable(ranking, func(a, b int) bool {
+		return scores[ranking[a]] > scores[ranking[b]]
+	})
+	return ranking
+}
+
+// silhouette is the mean silhouette coefficient of the labeled documents
+// using cosine distance: close to 1 when each label forms a tight, well
+// separated cluster, around 0 or below when labels overlap.
+func silhouette(vectors [][]float64, labels []string) float64 {
+	var total float64
+	var counted int
+
+	for i := range vectors {
+		sums := make(map[string]float64)
+		counts := make(map[string]int)
+		for j := range vectors {
+			if i == j {
+				continue
+			}
+			sums[labels[j]] += 1 - similarity.CosineDistance(vectors[i], vectors[j])
+			counts[labels[j]]++
+		}
+		if counts[labels[i]] == 0 {
+			continue
+		}
+
+		a := sums[labels[i]] / float64(counts[labels[i]])
+		b := math.Inf(1)
+		for label, sum := range sums {
+			if label != labels[i] {
+				b = math.Min(b, sum/float64(counts[label]))
+			}
+		}
+		if math.IsInf(b, 1) {
+			continue
+		}
+
+		if m := math.Max(a, b); m > 0 {
+			total += (b - a) / m
+		}
+		counted++
+	}
+
+	if counted == 0 {
+		return 0
+	}
+	return total / float64(counted)
+}
+
+// RunEmbedCommand benchmarks every model of the comma-separated list on
+// the corpus and prints a comparison table.
+func RunEmbedCommand(url, models, corpusPath string, k int) ([]EmbedResult, error) {
+	corpus, err := LoadEmbedCorpus(corpusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []EmbedResult
+	for _, model := range strings.Split(models, ",") {
+		model = strings.TrimSpace(model)
+		fmt.Printf("🧮 Embedding %d documents and %d queries with %s\n", len(corpus.Documents), len(corpus.Queries), model)
+
+		result, err := EvaluateEmbeddings(url, model, corpus, k)
+		if err != nil {
+			fmt.Printf("Error evaluating model %s: %v\n", model, err)
+			continue
+		}
+		results = append(results, result)
+	}
+
+	printEmbedSummary(results)
+	return results, nil
+}
+
+func printEmbedSummary(results []EmbedResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	k := results[0].K
+	fmt.Printf("\nEmbedding summary:\n")
+	fmt.Printf("%-28s %5s %9s %7s %9s %11s %10s %8s\n",
+		"Model", "Dim", fmt.Sprintf("Recall@%d", k), "MRR", fmt.Sprintf("nDCG@%d", k), "Silhouette", "Query", "Docs/s")
+	for _, r := range results {
+		fmt.Printf("%-28s %5d %9.3f %7.3f %9.3f %11.3f %10s %8.1f\n",
+			r.Model, r.Dimensions, r.RecallAtK, r.MRR, r.NDCGAtK, r.Silhouette,
+			r.QueryTime.Round(time.Millisecond), r.DocsPerSec)
+	}
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FIMSpan is the kind of region masked in a fill-in-the-middle case
+type FIMSpan string
+
+const (
+	FIMSpanLine     FIMSpan = "line"
+	FIMSpanBlock    FIMSpan = "block"
+	FIMSpanFunction FIMSpan = "function"
+)
+
+// FIMCase is a source file with one masked span
+type FIMCase struct {
+	File     string
+	Language string
+	Kind     FIMSpan
+	Line     int
+	Prefix   string
+	Middle   string
+	Suffix   string
+	// Buildable reports whether the package of the original Go file builds,
+	// so a failed build of the filled file is the completion's fault
+	Buildable bool
+}
+
+// Key identifies the case in results, e.g. "fim:server.go:block:42"
+func (c FIMCase) Key() PromptKey {
+	return PromptKey(fmt.Sprintf("fim:%s:%s:%d", filepath.Base(c.File), c.Kind, c.Line))
+}
+
+// FIMResult holds the scores of a fill-in-the-middle completion
+type FIMResult struct {
+	File           string  `json:"file"`
+	Kind           FIMSpan `json:"kind"`
+	Line           int     `json:"line"`
+	Expected       string  `json:"expected"`
+	ExactMatch     bool    `json:"exactMatch"`
+	EditSimilarity float64 `json:"editSimilarity"`
+	// Compiles and VetPasses are only set for Go files. VetPasses is only
+	// set when the package was built.
+	Compiles     *bool    `json:"compiles,omitempty"`
+	VetPasses    *bool    `json:"vetPasses,omitempty"`
+	CompileCheck string   `json:"compileCheck,omitempty"`
+	Errors       []string `json:"errors,omitempty"`
+}
+
+func ParseFIMSpans(input string) ([]FIMSpan, error) {
+	var spans []FIMSpan
+	for _, item := range strings.Split(input, ",") {
+		switch span := FIMSpan(strings.TrimSpace(item)); span {
+		case FIMSpanLine, FIMSpanBlock, FIMSpanFunction:
+			spans = append(spans, span)
+		default:
+			return nil, fmt.Errorf("invalid FIM span: %s", item)
+		}
+	}
+	return spans, nil
+}
+
+// span is a byte range of a source file and the line it starts on
+type span struct {
+	start, end, line int
+}
+
+// LoadFIMCases masks up to samples spans of each kind in every file
+func LoadFIMCases(files []string, kinds []FIMSpan, samples int) ([]FIMCase, error) {
+	var cases []FIMCase
+
+	for _, file := range files {
+		file = strings.TrimSpace(file)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		src := string(data)
+
+		var language string
+		switch filepath.Ext(file) {
+		case ".go":
+			language = "go"
+		case ".py":
+			language = "python"
+		default:
+			return nil, fmt.Errorf("unsupported FIM source %s: only .go and .py files are supported", file)
+		}
+
+		// Completions are built with the rest of their package. When the
+		// original package does not build (missing dependencies), they
+		// can only be parsed.
+		buildable := false
+		if language == "go" {
+			buildable, _, _ = checkGoPackage(file, src)
+		}
+
+		for _, kind := range kinds {
+			var spans []span
+			switch {
+			case kind == FIMSpanLine:
+				spans = lineSpans(src, language)
+			case language == "go":
+				spans, err = goSpans(file, src, kind)
+				if err != nil {
+					return nil, err
+				}
+			default:
+				spans = pythonSpans(src, kind)
+			}
+
+			for _, s := range spreadSpans(spans, samples) {
+				cases = append(cases, FIMCase{
+					File:     file,
+					Language: language,
+					Kind:     kind,
+					Line:     s.line,
+					Prefix:   src[:s.start],
+					Middle:   src[s.start:s.end],
+					Suffix:   src[s.end:],
+
+					Buildable: buildable,
+				})
+			}
+		}
+	}
+
+	return cases, nil
+}
+
+// spreadSpans picks up to n spans evenly spread over the file, so results
+// are reproducible without depending on the order of a random generator.
+func spreadSpans(spans []span, n int) []span {
+	if n <= 0 || len(spans) <= n {
+		return spans
+	}
+	picked := make([]span, 0, n)
+	for i := 0; i < n; i++ {
+		picked = append(picked, spans[i*len(spans)/n])
+	}
+	return picked
+}
+
+// lineSpans returns every code line worth masking: not blank, not a comment
+// and not a package, import or closing-brace line.
+func lineSpans(src, language string) []span {
+	var spans []span
+	offset := 0
+	for i, line := range strings.SplitAfter(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		skip := trimmed == "" || trimmed == "}" || trimmed == ")" ||
+			strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "#") ||
+			strings.HasPrefix(trimmed, "package ") || strings.HasPrefix(trimmed, "import ")
+		if !skip && len(trimmed) > 8 {
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			spans = append(spans, span{start: offset + indent, end: offset + len(strings.TrimRight(line, "\r\n")), line: i + 1})
+		}
+		offset += len(line)
+	}
+	return spans
+}
+
+// goSpans finds the bodies of functions or of inner blocks (if, for and
+// range statements) in a Go file, excluding the braces themselves.
+func goSpans(file, src string, kind FIMSpan) ([]span, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", file, err)
+	}
+
+	bodySpan := func(block *ast.BlockStmt) (span, bool) {
+		if block == nil || len(block.List) == 0 {
+			return span{}, false
+		}
+		start := fset.Position(block.Lbrace).Offset + 1
+		end := fset.Position(block.Rbrace).Offset
+		return span{start: start, end: end, line: fset.Position(block.List[0].Pos()).Line}, true
+	}
+
+	var spans []span
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if kind == FIMSpanFunction {
+				if s, ok := bodySpan(n.Body); ok {
+					spans = append(spans, s)
+				}
+			}
+		case *ast.IfStmt:
+			if kind == FIMSpanBlock {
+				if s, ok := bodySpan(n.Body); ok {
+					spans = append(spans, s)
+				}
+			}
+		case *ast.ForStmt:
+			if kind == FIMSpanBlock {
+				if s, ok := bodySpan(n.Body); ok {
+					spans = append(spans, s)
+				}
+			}
+		case *ast.RangeStmt:
+			if kind == FIMSpanBlock {
+				if s, ok := bodySpan(n.Body); ok {
+					spans = append(spans, s)
+				}
+			}
+		}
+		return true
+	})
+
+	return spans, nil
+}
+
+// pythonSpans finds the indented bodies of def statements (function) or of
+// if/for/while/with/try statements (block).
+func pythonSpans(src string, kind FIMSpan) []span {
+	lines := strings.SplitAfter(src, "\n")
+	offsets := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offsets[i+1] = offsets[i] + len(line)
+	}
+
+	indentOf := func(line string) int {
+		return len(line) - len(strings.TrimLeft(line, " \t"))
+	}
+
+	var spans []span
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasSuffix(trimmed, ":") {
+			continue
+		}
+		isDef := strings.HasPrefix(trimmed, "def ") || strings.HasPrefix(trimmed, "async def ")
+		isBlock := false
+		for _, keyword := range []string{"if ", "for ", "while ", "with ", "try:", "elif ", "else:"} {
+			if strings.HasPrefix(trimmed, keyword) {
+				isBlock = true
+			}
+		}
+		if (kind == FIMSpanFunction && !isDef) || (kind == FIMSpanBlock && !isBlock) {
+			continue
+		}
+
+		header := indentOf(line)
+		last := -1
+		for j := i + 1; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "" {
+				continue
+			}
+			if indentOf(lines[j]) <= header {
+				break
+			}
+			last = j
+		}
+		if last < 0 {
+			continue
+		}
+		end := offsets[last] + len(strings.TrimRight(lines[last], "\r\n"))
+		spans = append(spans, span{start: offsets[i+1], end: end, line: i + 2})
+	}
+
+	return spans
+}
+
+// TestFIM sends the prefix and suffix of a case and scores the completion
+func TestFIM(opts RunOptions, c FIMCase, configKey ConfigKey, config map[string]interface{}) (TestResult, error) {
+	startTime := time.Now()
+
+	options := OllamaOptions(config)
+	if opts.SeedSampling {
+		options["seed"] = opts.SampleSeed
+	}
+	answer, err := Generate(opts.URL, GenerateRequest{
+		Model:   opts.Model,
+		Prompt:  c.Prefix,
+		Suffix:  c.Suffix,
+		Options: options,
+	})
+	if err != nil {
+		return TestResult{}, fmt.Errorf("generation error: %v", err)
+	}
+
+	endTime := time.Now()
+
+	fim := &FIMResult{
+		File:           c.File,
+		Kind:           c.Kind,
+		Line:           c.Line,
+		Expected:       c.Middle,
+		ExactMatch:     normalizeCode(answer.Response) == normalizeCode(c.Middle),
+		EditSimilarity: EditSimilarity(normalizeCode(answer.Response), normalizeCode(c.Middle)),
+	}
+
+	if c.Language == "go" {
+		filled := c.Prefix + answer.Response + c.Suffix
+		if c.Buildable {
+			compiles, vet, errors := checkGoPackage(c.File, filled)
+			fim.Compiles, fim.Errors, fim.CompileCheck = &compiles, errors, "build"
+			if compiles {
+				fim.VetPasses = &vet
+			}
+		} else {
+			compiles, errors := parseGoFile(c.File, filled)
+			fim.Compiles, fim.Errors, fim.CompileCheck = &compiles, errors, "parse"
+		}
+	}
+
+	return TestResult{
+		Config:     configKey,
+		Prompt:     c.Key(),
+		Response:   answer.Response,
+		Options:    options,
+		DoneReason: answer.DoneReason,
+		Metrics:    MeasureResponse(answer.Response, endTime.Sub(startTime), answer.PromptEvalCount, answer.EvalCount, answer.EvalDuration),
+		Timestamp:  endTime,
+		FIM:        fim,
+	}, nil
+}
+
+// normalizeCode ignores trailing whitespace on each line and around the span
+func normalizeCode(code string) string {
+	lines := strings.Split(strings.TrimSpace(code), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fimBuildTimeout bounds each go build and go vet of a completion's
+// package. A cold build of a whole package takes longer than the code
+// grader's timeout.
+const fimBuildTimeout = 5 * time.Minute
+
+// parseGoFile checks that a Go file parses
+func parseGoFile(file, src string) (bool, []string) {
+	if _, err := parser.ParseFile(token.NewFileSet(), filepath.Base(file), src, parser.AllErrors); err != nil {
+		return false, []string{err.Error()}
+	}
+	return true, nil
+}
+
+// checkGoPackage builds and vets the package of a Go file with the file
+// replaced by src. The package directory, with the go.mod and go.sum of its
+// module, is copied to a scratch tree at the same relative path; a file
+// outside a module gets a module of its own.
+func checkGoPackage(file, src string) (compiles, vetPasses bool, errors []string) {
+	if ok, errors := parseGoFile(file, src); !ok {
+		return false, false, errors
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return false, false, []string{err.Error()}
+	}
+	dir := filepath.Dir(abs)
+
+	scratch, err := os.MkdirTemp("", "slm-fim-*")
+	if err != nil {
+		return false, false, []string{err.Error()}
+	}
+	defer os.RemoveAll(scratch)
+
+	pkg := scratch
+	if root := goModuleRoot(dir); root == "" {
+		err = os.WriteFile(filepath.Join(scratch, "go.mod"), []byte("module fim\n\ngo 1.21\n"), 0o644)
+	} else {
+		rel, _ := filepath.Rel(root, dir)
+		pkg = filepath.Join(scratch, rel)
+		err = copyGoPackage(root, dir, scratch, pkg)
+	}
+	if err == nil {
+		err = os.WriteFile(filepath.Join(pkg, filepath.Base(file)), []byte(src), 0o644)
+	}
+	if err != nil {
+		return false, false, []string{err.Error()}
+	}
+
+	if out, err := runGo(pkg, fimBuildTimeout, "build", "-o", os.DevNull, "."); err != nil {
+		return false, false, goCheckErrors("build", out, err)
+	}
+	if out, err := runGo(pkg, fimBuildTimeout, "vet", "."); err != nil {
+		return true, false, goCheckErrors("vet", out, err)
+	}
+	return true, true, nil
+}
+
+// goCheckErrors returns the diagnostics of a failed go build or vet
+func goCheckErrors(step string, out []byte, err error) []string {
+	if err == context.DeadlineExceeded {
+		return []string{fmt.Sprintf("go %s timed out after %v", step, fimBuildTimeout)}
+	}
+	if errors := toolchainErrors(out); len(errors) > 0 {
+		return errors
+	}
+	return []string{fmt.Sprintf("go %s: %v", step, err)}
+}
+
+// goModuleRoot returns the closest directory at or above dir holding a
+// go.mod, or "" when there is none
+func goModuleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// copyGoPackage copies go.mod and go.sum from the module root, and the
+// regular files of the package directory, into a scratch tree
+func copyGoPackage(root, dir, scratch, pkg string) error {
+	if err := os.MkdirAll(pkg, 0o755); err != nil {
+		return err
+	}
+	copyFile := func(src, dst string) error {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dst, data, 0o644)
+	}
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if err := copyFile(filepath.Join(root, name), filepath.Join(scratch, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(dir, entry.Name()), filepath.Join(pkg, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EditSimilarity is 1 minus the Levenshtein distance between a and b over
+// the length of the longer one, computed on runes.
+func EditSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	if longest == 0 {
+		return 1
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// RunFIM runs every FIM case with every config
+func RunFIM(opts RunOptions, cases []FIMCase, configs []ConfigKey) []TestResult {
+	var results []TestResult
+
+	for _, c := range cases {
+		for _, config := range configs {
+			fmt.Printf("🤖 Running '%s' with %s configuration:\n", c.Key(), config)
+
+			result, err := TestFIM(opts, c, config, Configs[config])
+			if err != nil {
+				fmt.Printf("Error testing %s with config %s: %v\n", c.Key(), config, err)
+				continue
+			}
+
+			if opts.Print {
+				printResponse(result)
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// printFIMSummary reports FIM scores per config and span kind
+func printFIMSummary(results []TestResult) {
+	type totals struct {
+		runs, exact, goRuns, compiles int
+		vetRuns, vetPasses            int
+		similarity                    float64
+	}
+	groups := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.FIM == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s", result.Config, result.FIM.Kind)
+		t, ok := groups[key]
+		if !ok {
+			t = &totals{}
+			groups[key] = t
+		}
+		t.runs++
+		if result.FIM.ExactMatch {
+			t.exact++
+		}
+		t.similarity += result.FIM.EditSimilarity
+		if result.FIM.Compiles != nil {
+			t.goRuns++
+			if *result.FIM.Compiles {
+				t.compiles++
+			}
+		}
+		if result.FIM.VetPasses != nil {
+			t.vetRuns++
+			if *result.FIM.VetPasses {
+				t.vetPasses++
+			}
+		}
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Printf("\nFill-in-the-middle summary:\n")
+	fmt.Printf("%-30s %6s %7s %11s %9s %9s\n", "Config/Span", "Runs", "Exact", "Similarity", "Compiles", "Vet")
+	for _, key := range sortedKeys(groups) {
+		t := groups[key]
+		n := float64(t.runs)
+		compiles := "-"
+		if t.goRuns > 0 {
+			compiles = fmt.Sprintf("%.0f%%", 100*float64(t.compiles)/float64(t.goRuns))
+		}
+		vet := "-"
+		if t.vetRuns > 0 {
+			vet = fmt.Sprintf("%.0f%%", 100*float64(t.vetPasses)/float64(t.vetRuns))
+		}
+		fmt.Printf("%-30s %6d %6.0f%% %11.2f %9s %9s\n", key, t.runs, 100*float64(t.exact)/n, t.similarity/n, compiles, vet)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Generator defaults, overridden by -seed and -instances
+const (
+	defaultSeed      = 1
+	defaultInstances = 10
+)
+
+// PromptInstance is one generated variant of a prompt with its computed
+// answer. Grader checks responses against that answer.
+type PromptInstance struct {
+	Index  int    `json:"index"`
+	Seed   int64  `json:"seed"`
+	Text   string `json:"text"`
+	Answer string `json:"answer"`
+	Grader Grader `json:"-"`
+}
+
+// Generator produces a fresh prompt instance from a seeded source
+type Generator func(r *rand.Rand) PromptInstance
+
+// GenerateInstances returns n instances of a generated prompt. The source is
+// seeded from seed and the prompt key, so every prompt gets its own
+// reproducible sequence and all configs see the same instances.
+func GenerateInstances(key PromptKey, generate Generator, seed int64, n int) []PromptInstance {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	r := rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+
+	instances := make([]PromptInstance, n)
+	for i := range instances {
+		instances[i] = generate(r)
+		instances[i].Index = i
+		instances[i].Seed = seed
+	}
+	return instances
+}
+
+var numberWords = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten"}
+
+var letterCountWords = []string{
+	"strawberry", "bookkeeper", "mississippi", "committee", "occurrence", "parallel",
+	"embarrass", "accommodate", "assessment", "banana", "coffee", "balloon",
+	"successful", "possession", "millennium", "referee", "tomorrow", "necessary",
+	"address", "beginning", "cinnamon", "difficult", "excellence", "giraffe",
+	"hippopotamus", "independence", "kangaroo", "lollipop", "narrative", "pepperoni",
+}
+
+// generateLetterCount asks how often a letter occurs in a word, a classic
+// tokenization trap. One time in five the letter is absent from the word.
+func generateLetterCount(r *rand.Rand) PromptInstance {
+	word := letterCountWords[r.Intn(len(letterCountWords))]
+	letter := rune(word[r.Intn(len(word))])
+	if r.Intn(5) == 0 {
+		for strings.ContainsRune(word, letter) {
+			letter = rune('a' + r.Intn(26))
+		}
+	}
+	count := strings.Count(word, string(letter))
+
+	return PromptInstance{
+		Text:   fmt.Sprintf("How many times does the letter '%c' appear in the word '%s'?", letter, word),
+		Answer: strconv.Itoa(count),
+		Grader: ExactGrader{Answers: []*big.Rat{big.NewRat(int64(count), 1)}, Words: true},
+	}
+}
+
+// generateClockAngle asks for the smaller angle between the clock hands
+func generateClockAngle(r *rand.Rand) PromptInstance {
+	hour, minute := 1+r.Intn(12), r.Intn(60)
+
+	// The hour hand moves 0.5° per minute, the minute hand 6°: work in half
+	// degrees to stay exact.
+	halfDegrees := (60*(hour%12) + minute) - 12*minute
+	if halfDegrees < 0 {
+		halfDegrees = -halfDegrees
+	}
+	if halfDegrees > 360 {
+		halfDegrees = 720 - halfDegrees
+	}
+	angle := strconv.Itoa(halfDegrees / 2)
+	if halfDegrees%2 == 1 {
+		angle += ".5"
+	}
+
+	return PromptInstance{
+		Text:   fmt.Sprintf("If a clock shows %d:%02d, what is the smaller angle between the hour and minute hands, in degrees?", hour, minute),
+		Answer: angle,
+		Grader: ExactGrader{Answers: []*big.Rat{mustRat(angle)}},
+	}
+}
+
+// generateDice asks for a dice probability, computed by enumerating every
+// outcome and reported as a reduced fraction.
+func generateDice(r *rand.Rand) PromptInstance {
+	dice := 2 + r.Intn(2)
+
+	var question string
+	var event func(rolls []int) bool
+	switch r.Intn(3) {
+	case 0:
+		total := dice + r.Intn(5*dice+1)
+		question = fmt.Sprintf("rolling a total of exactly %d with %d fair six-sided dice", total, dice)
+		event = func(rolls []int) bool {
+			sum := 0
+			for _, roll := range rolls {
+				sum += roll
+			}
+			return sum == total
+		}
+	case 1:
+		face := 1 + r.Intn(6)
+		question = fmt.Sprintf("rolling at least one %d with %d fair six-sided dice", face, dice)
+		event = func(rolls []int) bool {
+			for _, roll := range rolls {
+				if roll == face {
+					return true
+				}
+			}
+			return false
+		}
+	default:
+		question = fmt.Sprintf("rolling the same number on all %d fair six-sided dice", dice)
+		event = func(rolls []int) bool {
+			for _, roll := range rolls {
+				if roll != rolls[0] {
+					return false
+				}
+			}
+			return true
+		}
+	}
+
+	outcomes, favorable := 0, 0
+	rolls := make([]int, dice)
+	var enumerate func(i int)
+	enumerate = func(i int) {
+		if i == dice {
+			outcomes++
+			if event(rolls) {
+				favorable++
+			}
+			return
+		}
+		for face := 1; face <= 6; face++ {
+			rolls[i] = face
+			enumerate(i + 1)
+		}
+	}
+	enumerate(0)
+
+	probability := big.NewRat(int64(favorable), int64(outcomes))
+	return PromptInstance{
+		Text:   fmt.Sprintf("What is the probability of %s? Give the answer as a reduced fraction.", question),
+		Answer: probability.RatString(),
+		Grader: ExactGrader{Answers: []*big.Rat{probability}},
+	}
+}
+
+var percentages = []string{"5", "12.5", "15", "20", "25", "35", "40", "62.5", "75", "120"}
+
+// generatePercentage asks for a percentage of a number or for the
+// percentage one number is of another, with exact decimal answers.
+func generatePercentage(r *rand.Rand) PromptInstance {
+	percent, _ := new(big.Rat).SetString(percentages[r.Intn(len(percentages))])
+	base := big.NewRat(int64(8*(1+r.Intn(125))), 1)
+	part := new(big.Rat).Mul(base, new(big.Rat).Quo(percent, big.NewRat(100, 1)))
+
+	if r.Intn(2) == 0 {
+		return PromptInstance{
+			Text:   fmt.Sprintf("What is %s%% of %s?", ratDecimal(percent), ratDecimal(base)),
+			Answer: ratDecimal(part),
+			Grader: ExactGrader{Answers: []*big.Rat{part}},
+		}
+	}
+	return PromptInstance{
+		Text:   fmt.Sprintf("%s is what percent of %s?", ratDecimal(part), ratDecimal(base)),
+		Answer: ratDecimal(percent),
+		Grader: ExactGrader{Answers: []*big.Rat{percent}, Percent: true},
+	}
+}
+
+// ratDecimal formats a rational with a terminating decimal expansion
+// without trailing zeros.
+func ratDecimal(x *big.Rat) string {
+	s := x.FloatString(6)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+var (
+	syllogismTerms = []string{"blickets", "daxes", "wugs", "feps", "zorbs", "glims", "tovs", "quands", "snerps", "vlogs"}
+	syllogismForms = []struct {
+		premises, question, answer string
+	}{
+		{"All %[1]s are %[2]s. All %[2]s are %[3]s.", "Are all %[1]s %[3]s?", "yes"},
+		{"No %[1]s are %[2]s. All %[3]s are %[1]s.", "Are any %[3]s %[2]s?", "no"},
+		{"All %[1]s are %[2]s. All %[3]s are %[2]s.", "Are all %[1]s %[3]s?", "cannot be determined"},
+		{"Some %[1]s are %[2]s. Some %[2]s are %[3]s.", "Are some %[1]s %[3]s?", "cannot be determined"},
+		{"All %[1]s are %[2]s. Some %[3]s are %[1]s.", "Are some %[3]s %[2]s?", "yes"},
+		{"No %[2]s are %[3]s. All %[1]s are %[2]s.", "Are any %[1]s %[3]s?", "no"},
+	}
+)
+
+// generateSyllogism builds a syllogism over nonsense terms, so the answer
+// follows from the premises alone. Premises and reasoning mention "no" and
+// "yes" too, so the answer is read from the final answer line.
+func generateSyllogism(r *rand.Rand) PromptInstance {
+	terms := r.Perm(len(syllogismTerms))[:3]
+	a, b, c := syllogismTerms[terms[0]], syllogismTerms[terms[1]], syllogismTerms[terms[2]]
+	form := syllogismForms[r.Intn(len(syllogismForms))]
+
+	return PromptInstance{
+		Text: fmt.Sprintf(form.premises+" "+form.question+
+			" End with a line of the form 'Answer: yes', 'Answer: no' or 'Answer: cannot be determined'.", a, b, c),
+		Answer: form.answer,
+		Grader: ChoiceGrader{
+			Answer:  form.answer,
+			Choices: []string{"yes", "no", "cannot be determined"},
+			Final:   true,
+		},
+	}
+}
+
+// printGeneratedSummary reports accuracy over the generated instances of
+// each prompt per config.
+func printGeneratedSummary(results []TestResult) {
+	type totals struct {
+		runs, correct int
+	}
+	groups := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.Instance == nil || result.Grade == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s/%s", result.Config, result.Prompt)
+		t, ok := groups[key]
+		if !ok {
+			t = &totals{}
+			groups[key] = t
+		}
+		t.runs++
+		if result.Grade.Passed {
+			t.correct++
+		}
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Printf("\nGenerated prompts summary:\n")
+	fmt.Printf("%-40s %9s %9s\n", "Config/Prompt", "Instances", "Accuracy")
+	for _, key := range sortedKeys(groups) {
+		t := groups[key]
+		fmt.Printf("%-40s %9d %8.1f%%\n", key, t.runs, 100*float64(t.correct)/float64(t.runs))
+	}
+}
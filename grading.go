@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Keyword and choice grader verdicts
+const (
+	VerdictMissingKeywords = "missing_keywords"
+	VerdictNoChoice        = "no_choice"
+	VerdictWrongChoice     = "wrong_choice"
+)
+
+// Grader scores a response against a prompt's reference answer
+type Grader interface {
+	// Name identifies the grader in results and summaries
+	Name() string
+	// Grade checks a single response
+	Grade(response string) *Grade
+}
+
+// Grade is the outcome of grading one response
+type Grade struct {
+	Grader  string  `json:"grader"`
+	Score   float64 `json:"score"`
+	Passed  bool    `json:"passed"`
+	Verdict string  `json:"verdict"`
+	Details string  `json:"details,omitempty"`
+
+	// Passes and Total count the individual checks behind Score, when the
+	// grader runs several (tests, constraints, ...)
+	Passes int `json:"passes,omitempty"`
+	Total  int `json:"total,omitempty"`
+	// Errors lists diagnostics such as compiler errors
+	Errors []string `json:"errors,omitempty"`
+}
+
+// printGradeSummary reports pass rates, mean scores and verdict counts per
+// config for every graded result.
+func printGradeSummary(results []TestResult) {
+	type totals struct {
+		runs, passed int
+		score        float64
+		verdicts     map[string]int
+	}
+	byConfig := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.Grade == nil {
+			continue
+		}
+		t, ok := byConfig[string(result.Config)]
+		if !ok {
+			t = &totals{verdicts: make(map[string]int)}
+			byConfig[string(result.Config)] = t
+		}
+		t.runs++
+		if result.Grade.Passed {
+			t.passed++
+		}
+		t.score += result.Grade.Score
+		t.verdicts[result.Grade.Verdict]++
+	}
+
+	if len(byConfig) == 0 {
+		return
+	}
+
+	fmt.Printf("\nGrading summary:\n")
+	fmt.Printf("%-20s %6s %8s %7s  %s\n", "Config", "Runs", "Passed", "Score", "Verdicts")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		summary := ""
+		for i, verdict := range sortedKeys(t.verdicts) {
+			if i > 0 {
+				summary += ", "
+			}
+			summary += fmt.Sprintf("%s=%d", verdict, t.verdicts[verdict])
+		}
+		n := float64(t.runs)
+		fmt.Printf("%-20s %6d %7.0f%% %7.2f  %s\n", config, t.runs, 100*float64(t.passed)/n, t.score/n, summary)
+	}
+}
+
+// KeywordGrader checks that a response mentions the expected answer. Every
+// entry of All must appear, and at least one entry of Any when it is set.
+// Matching is case-insensitive and on whole words.
+type KeywordGrader struct {
+	All []string
+	Any []string
+}
+
+func (g KeywordGrader) Name() string { return "keywords" }
+
+func (g KeywordGrader) Grade(response string) *Grade {
+	grade := &Grade{Grader: g.Name()}
+
+	var missing []string
+	for _, keyword := range g.All {
+		if containsWord(response, keyword) {
+			grade.Passes++
+		} else {
+			missing = append(missing, keyword)
+		}
+	}
+	grade.Total = len(g.All)
+
+	if len(g.Any) > 0 {
+		grade.Total++
+		found := false
+		for _, keyword := range g.Any {
+			if containsWord(response, keyword) {
+				found = true
+				break
+			}
+		}
+		if found {
+			grade.Passes++
+		} else {
+			missing = append(missing, "one of "+strings.Join(g.Any, "/"))
+		}
+	}
+
+	if grade.Total > 0 {
+		grade.Score = float64(grade.Passes) / float64(grade.Total)
+	}
+	grade.Passed = len(missing) == 0
+	if grade.Passed {
+		grade.Verdict = VerdictCorrect
+	} else {
+		grade.Verdict = VerdictMissingKeywords
+		grade.Details = "missing: " + strings.Join(missing, ", ")
+	}
+
+	return grade
+}
+
+// Extract returns the expected keywords the response mentions, as the
+// answer it gives
+func (g KeywordGrader) Extract(response string) string {
+	var found []string
+	for _, keyword := range append(append([]string{}, g.All...), g.Any...) {
+		if containsWord(response, keyword) {
+			found = append(found, strings.ToLower(keyword))
+		}
+	}
+	return strings.Join(found, ", ")
+}
+
+// Correct reports whether an extracted answer names every keyword of All
+// and one of Any
+func (g KeywordGrader) Correct(answer string) bool {
+	named := make(map[string]bool)
+	for _, keyword := range strings.Split(answer, ", ") {
+		named[keyword] = true
+	}
+	for _, keyword := range g.All {
+		if !named[strings.ToLower(keyword)] {
+			return false
+		}
+	}
+	if len(g.Any) == 0 {
+		return true
+	}
+	for _, keyword := range g.Any {
+		if named[strings.ToLower(keyword)] {
+			return true
+		}
+	}
+	return false
+}
+
+// ChoiceGrader grades multiple-choice answers: the first of Choices
+// mentioned in the response is taken as the model's answer. Final looks at
+// the conclusion instead, for prompts whose working mentions every choice.
+type ChoiceGrader struct {
+	Answer  string
+	Choices []string
+	Final   bool
+}
+
+func (g ChoiceGrader) Name() string { return "choice" }
+
+func (g ChoiceGrader) Grade(response string) *Grade {
+	grade := &Grade{Grader: g.Name(), Total: 1}
+
+	chosen := g.Extract(response)
+	switch {
+	case chosen == "":
+		grade.Verdict = VerdictNoChoice
+		grade.Details = "none of " + strings.Join(g.Choices, "/") + " found"
+	case strings.EqualFold(chosen, g.Answer):
+		grade.Verdict = VerdictCorrect
+		grade.Passed = true
+		grade.Passes = 1
+		grade.Score = 1
+	default:
+		grade.Verdict = VerdictWrongChoice
+		grade.Details = fmt.Sprintf("answered %q, expected %q", chosen, g.Answer)
+	}
+
+	return grade
+}
+
+// Extract returns the choice taken as the model's answer, or "". With
+// Final, it is the first choice of the last sentence mentioning one, so
+// "Q2 has the best margin, ahead of Q4" still answers Q2.
+func (g ChoiceGrader) Extract(response string) string {
+	if g.Final {
+		last := -1
+		for _, choice := range g.Choices {
+			last = max(last, lastWordIndex(response, choice))
+		}
+		if last < 0 {
+			return ""
+		}
+		response = response[sentenceStart(response, last):]
+	}
+
+	chosen, at := "", -1
+	for _, choice := range g.Choices {
+		if i := wordIndex(response, choice); i >= 0 && (at < 0 || i < at) {
+			chosen, at = choice, i
+		}
+	}
+	return chosen
+}
+
+// Correct reports whether an extracted choice is the expected one
+func (g ChoiceGrader) Correct(answer string) bool {
+	return strings.EqualFold(answer, g.Answer)
+}
+
+// sentenceStart returns the offset of the sentence containing text[at:]:
+// just after the last line break, or sentence-ending punctuation followed
+// by a space, before at.
+func sentenceStart(text string, at int) int {
+	for i := at - 1; i > 0; i-- {
+		if text[i] == '\n' {
+			return i + 1
+		}
+		if (text[i] == ' ' || text[i] == '\t') && strings.ContainsRune(".!?", rune(text[i-1])) {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// containsWord reports whether keyword appears in text, case-insensitively,
+// not surrounded by other letters or digits.
+func containsWord(text, keyword string) bool {
+	return wordIndex(text, keyword) >= 0
+}
+
+// wordIndex returns the byte offset of the first whole-word occurrence of
+// keyword in text, or -1.
+func wordIndex(text, keyword string) int {
+	if match := wordPattern(keyword).FindStringSubmatchIndex(text); match != nil {
+		return match[2]
+	}
+	return -1
+}
+
+// lastWordIndex returns the byte offset of the last whole-word occurrence
+// of keyword in text, or -1.
+func lastWordIndex(text, keyword string) int {
+	pattern := wordPattern(keyword)
+	last := -1
+	for start := 0; start < len(text); {
+		match := pattern.FindStringSubmatchIndex(text[start:])
+		if match == nil {
+			break
+		}
+		last = start + match[2]
+		start += match[3]
+	}
+	return last
+}
+
+func wordPattern(keyword string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])(` + regexp.QuoteMeta(strings.TrimSpace(keyword)) + `)(?:$|[^\p{L}\p{N}])`)
+}
@@ -0,0 +1,155 @@
+package main
+
+// languageSamples are the training texts of the Latin-script trigram
+// profiles. They are everyday prose about a town festival and a train
+// journey, unrelated to the prompts and their expected answers, so the
+// profiles pick up function words and spelling rather than the vocabulary
+// being graded.
+var languageSamples = map[string]string{
+	"en": `The weather was warm and the streets were full of people who had come
+to see the parade. Children sat on their parents' shoulders while the band played
+old songs that everyone seemed to know. After the last float passed, the crowd
+moved slowly toward the river, where food stalls were selling bread, cheese and
+fresh fruit. Most of the shops had closed early, but the small bookstore on the
+corner stayed open until midnight. Its owner said that this was the busiest day of
+the year and that she would not miss it for anything. When the sun went down, the
+lights along the bridge were turned on and music could be heard from every
+direction. It is important to remember that these traditions are older than the
+city itself, and they have survived wars, floods and changes of government.
+The next morning the square was quiet again, and only a few old men sat by the
+fountain, reading their newspapers and arguing about the price of apples.
+
+The train left the station a little after seven. My grandmother had packed
+sandwiches, two boiled eggs and a bottle of cold tea, and she insisted that we eat
+before the conductor came by. Outside the window, the fields were still grey with
+frost, and the farmhouses looked small and lonely under the low sky. She told me
+stories about her own childhood, when the journey took a whole day and people
+brought blankets because the carriages were never heated. By the time we reached
+the coast, the clouds had cleared and we could see the boats in the harbour.`,
+
+	"fr": `Le temps était doux et les rues étaient pleines de gens venus voir le
+défilé. Les enfants étaient assis sur les épaules de leurs parents pendant que la
+fanfare jouait de vieilles chansons que tout le monde semblait connaître. Après le
+passage du dernier char, la foule s'est dirigée lentement vers la rivière, où des
+stands vendaient du pain, du fromage et des fruits frais. La plupart des magasins
+avaient fermé tôt, mais la petite librairie au coin de la rue est restée ouverte
+jusqu'à minuit. Sa propriétaire a dit que c'était le jour le plus chargé de l'année
+et qu'elle ne le manquerait pour rien au monde. Quand le soleil s'est couché, les
+lumières le long du pont se sont allumées et on entendait de la musique dans toutes
+les directions. Il faut se souvenir que ces traditions sont plus anciennes que la
+ville elle-même. Le lendemain matin, la place était de nouveau calme, et seuls
+quelques vieux messieurs lisaient leur journal près de la fontaine.
+
+Le train a quitté la gare un peu après sept heures. Ma grand-mère avait préparé
+des sandwichs, deux œufs durs et une bouteille de thé froid, et elle tenait à ce
+que nous mangions avant le passage du contrôleur. Par la fenêtre, les champs étaient
+encore gris de givre, et les fermes semblaient petites et seules sous le ciel bas.
+Elle m'a raconté des histoires de son enfance, quand le voyage durait toute une
+journée et que les gens apportaient des couvertures parce que les wagons n'étaient
+jamais chauffés. Quand nous sommes arrivés sur la côte, les nuages s'étaient
+dissipés et nous pouvions voir les bateaux dans le port.`,
+
+	"es": `El tiempo era agradable y las calles estaban llenas de gente que había
+venido a ver el desfile. Los niños iban sentados sobre los hombros de sus padres
+mientras la banda tocaba canciones antiguas que todos parecían conocer. Después de
+que pasara la última carroza, la multitud se dirigió lentamente hacia el río, donde
+los puestos vendían pan, queso y fruta fresca. La mayoría de las tiendas habían
+cerrado temprano, pero la pequeña librería de la esquina se quedó abierta hasta la
+medianoche. Su dueña dijo que era el día con más trabajo del año y que no se lo
+perdería por nada. Cuando se puso el sol, se encendieron las luces a lo largo del
+puente y se oía música en todas las direcciones. Es importante recordar que estas
+tradiciones son más antiguas que la propia ciudad. A la mañana siguiente la plaza
+volvió a estar tranquila, y solo unos ancianos leían el periódico junto a la fuente.
+
+El tren salió de la estación poco después de las siete. Mi abuela había preparado
+bocadillos, dos huevos duros y una botella de té frío, y insistió en que comiéramos
+antes de que pasara el revisor. Por la ventana, los campos seguían grises por la
+escarcha, y las casas de campo parecían pequeñas y solitarias bajo el cielo bajo.
+Me contó historias de su infancia, cuando el viaje duraba un día entero y la gente
+llevaba mantas porque los vagones nunca tenían calefacción. Cuando llegamos a la
+costa, las nubes se habían despejado y podíamos ver los barcos en el puerto.`,
+
+	"de": `Das Wetter war mild und die Straßen waren voller Menschen, die gekommen
+waren, um den Umzug zu sehen. Die Kinder saßen auf den Schultern ihrer Eltern,
+während die Kapelle alte Lieder spielte, die jeder zu kennen schien. Nachdem der
+letzte Wagen vorbeigefahren war, bewegte sich die Menge langsam zum Fluss, wo an
+den Ständen Brot, Käse und frisches Obst verkauft wurden. Die meisten Geschäfte
+hatten früh geschlossen, aber die kleine Buchhandlung an der Ecke blieb bis
+Mitternacht geöffnet. Die Besitzerin sagte, dass dies der geschäftigste Tag des
+Jahres sei und dass sie ihn um nichts in der Welt verpassen wolle. Als die Sonne
+unterging, wurden die Lichter entlang der Brücke eingeschaltet, und aus allen
+Richtungen war Musik zu hören. Man muss sich daran erinnern, dass diese
+Traditionen älter sind als die Stadt selbst. Am nächsten Morgen war der Platz
+wieder still, und nur ein paar alte Männer lasen am Brunnen ihre Zeitung.
+
+Der Zug verließ den Bahnhof kurz nach sieben. Meine Großmutter hatte Brote, zwei
+gekochte Eier und eine Flasche kalten Tee eingepackt, und sie bestand darauf, dass
+wir aßen, bevor der Schaffner kam. Draußen vor dem Fenster waren die Felder noch
+grau vom Frost, und die Bauernhöfe wirkten klein und einsam unter dem tiefen
+Himmel. Sie erzählte mir Geschichten aus ihrer Kindheit, als die Reise einen ganzen
+Tag dauerte und die Leute Decken mitbrachten, weil die Wagen nie geheizt waren. Als
+wir die Küste erreichten, hatten sich die Wolken verzogen, und wir konnten die
+Boote im Hafen sehen.`,
+
+	"it": `Il tempo era mite e le strade erano piene di gente venuta a vedere la
+sfilata. I bambini sedevano sulle spalle dei genitori mentre la banda suonava
+vecchie canzoni che tutti sembravano conoscere. Dopo il passaggio dell'ultimo
+carro, la folla si è diretta lentamente verso il fiume, dove le bancarelle
+vendevano pane, formaggio e frutta fresca. La maggior parte dei negozi aveva chiuso
+presto, ma la piccola libreria all'angolo è rimasta aperta fino a mezzanotte. La
+proprietaria ha detto che era il giorno più affollato dell'anno e che non se lo
+sarebbe perso per niente al mondo. Quando il sole è tramontato, le luci lungo il
+ponte si sono accese e si sentiva musica da ogni direzione. Bisogna ricordare che
+queste tradizioni sono più antiche della città stessa. La mattina dopo la piazza
+era di nuovo tranquilla, e solo alcuni anziani leggevano il giornale vicino alla
+fontana.
+
+Il treno è partito dalla stazione poco dopo le sette. Mia nonna aveva preparato
+dei panini, due uova sode e una bottiglia di tè freddo, e ha insistito perché
+mangiassimo prima che passasse il controllore. Fuori dal finestrino i campi erano
+ancora grigi di brina, e le case di campagna sembravano piccole e sole sotto il
+cielo basso. Mi ha raccontato storie della sua infanzia, quando il viaggio durava
+un giorno intero e la gente portava le coperte perché le carrozze non erano mai
+riscaldate. Quando siamo arrivati sulla costa, le nuvole si erano diradate e
+potevamo vedere le barche nel porto.`,
+
+	"pt": `O tempo estava ameno e as ruas estavam cheias de pessoas que tinham vindo
+ver o desfile. As crianças iam sentadas nos ombros dos pais enquanto a banda tocava
+canções antigas que todos pareciam conhecer. Depois que o último carro passou, a
+multidão seguiu devagar em direção ao rio, onde as barracas vendiam pão, queijo e
+frutas frescas. A maioria das lojas tinha fechado cedo, mas a pequena livraria da
+esquina ficou aberta até a meia-noite. A dona disse que era o dia mais movimentado
+do ano e que não o perderia por nada. Quando o sol se pôs, as luzes ao longo da
+ponte foram acesas e ouvia-se música em todas as direções. É importante lembrar que
+essas tradições são mais antigas do que a própria cidade. Na manhã seguinte, a
+praça estava de novo tranquila, e só alguns velhos liam o jornal junto à fonte.
+
+O comboio saiu da estação pouco depois das sete. A minha avó tinha preparado
+sanduíches, dois ovos cozidos e uma garrafa de chá frio, e fez questão de que
+comêssemos antes de o revisor passar. Pela janela, os campos ainda estavam
+cinzentos de geada, e as casas de quinta pareciam pequenas e sozinhas debaixo do
+céu baixo. Ela contou-me histórias da sua infância, quando a viagem demorava um dia
+inteiro e as pessoas levavam cobertores porque as carruagens nunca eram aquecidas.
+Quando chegámos à costa, as nuvens tinham desaparecido e podíamos ver os barcos no
+porto.`,
+
+	"nl": `Het weer was zacht en de straten waren vol mensen die gekomen waren om
+de optocht te zien. De kinderen zaten op de schouders van hun ouders terwijl de
+fanfare oude liedjes speelde die iedereen leek te kennen. Nadat de laatste wagen
+voorbij was gereden, liep de menigte langzaam naar de rivier, waar kraampjes brood,
+kaas en vers fruit verkochten. De meeste winkels waren vroeg gesloten, maar de
+kleine boekwinkel op de hoek bleef tot middernacht open. De eigenaar zei dat het de
+drukste dag van het jaar was en dat ze die voor niets ter wereld wilde missen. Toen
+de zon onderging, werden de lichten langs de brug aangezet en was er overal muziek
+te horen. Het is belangrijk om te onthouden dat deze tradities ouder zijn dan de
+stad zelf. De volgende ochtend was het plein weer stil, en alleen een paar oude
+mannen lazen bij de fontein hun krant.
+
+De trein vertrok even na zevenen van het station. Mijn grootmoeder had
+boterhammen, twee gekookte eieren en een fles koude thee ingepakt, en ze stond erop
+dat we aten voordat de conducteur langskwam. Buiten het raam waren de velden nog
+grijs van de vorst, en de boerderijen zagen er klein en eenzaam uit onder de lage
+lucht. Ze vertelde me verhalen over haar eigen jeugd, toen de reis een hele dag
+duurde en mensen dekens meenamen omdat de wagons nooit verwarmd waren. Toen we de
+kust bereikten, waren de wolken verdwenen en konden we de boten in de haven zien.`,
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minSegmentLetters is the number of letters a Latin-script segment needs
+// for its trigrams to identify a language; shorter segments are "und".
+const minSegmentLetters = 8
+
+// scriptTables are the Unicode scripts reported by the script analyzer
+var scriptTables = []struct {
+	Name  string
+	Table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Devanagari", unicode.Devanagari},
+	{"Thai", unicode.Thai},
+	{"Hangul", unicode.Hangul},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Han", unicode.Han},
+}
+
+// scriptLanguages maps the scripts written by a single language of the
+// identifier to that language.
+var scriptLanguages = map[string]string{
+	"Cyrillic":   "ru",
+	"Greek":      "el",
+	"Arabic":     "ar",
+	"Hebrew":     "he",
+	"Devanagari": "hi",
+	"Thai":       "th",
+	"Hangul":     "ko",
+}
+
+// scriptAliases name groups of scripts in assertions
+var scriptAliases = map[string][]string{
+	"Japanese": {"Hiragana", "Katakana", "Han"},
+	"Chinese":  {"Han"},
+	"Korean":   {"Hangul"},
+}
+
+// scriptOf returns the script of a letter, or "" for common characters
+// (digits, punctuation, spaces) and scripts the analyzer does not track.
+func scriptOf(r rune) string {
+	if !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) {
+		return ""
+	}
+	for _, s := range scriptTables {
+		if unicode.Is(s.Table, r) {
+			return s.Name
+		}
+	}
+	return ""
+}
+
+// ScriptSegment is a run of text in one script family. Han, Hiragana and
+// Katakana form a single CJK family so Japanese sentences stay together.
+type ScriptSegment struct {
+	Script   string `json:"script"`
+	Text     string `json:"text"`
+	Letters  int    `json:"letters"`
+	Language string `json:"language"`
+}
+
+func scriptFamily(script string) string {
+	switch script {
+	case "Han", "Hiragana", "Katakana":
+		return "CJK"
+	}
+	return script
+}
+
+// ScriptSegments splits text into runs of one script family, per line.
+// Common characters stay in the run they appear in.
+func ScriptSegments(text string) []ScriptSegment {
+	var segments []ScriptSegment
+	for _, line := range strings.Split(text, "\n") {
+		var current *ScriptSegment
+		var builder strings.Builder
+		flush := func() {
+			if current != nil {
+				current.Text = strings.TrimSpace(builder.String())
+				segments = append(segments, *current)
+			}
+			current = nil
+			builder.Reset()
+		}
+
+		for _, r := range line {
+			family := scriptFamily(scriptOf(r))
+			if family != "" && (current == nil || current.Script != family) {
+				flush()
+				current = &ScriptSegment{Script: family}
+			}
+			if current == nil {
+				continue
+			}
+			if family != "" {
+				current.Letters++
+			}
+			builder.WriteRune(r)
+		}
+		flush()
+	}
+	return segments
+}
+
+// trigramProfile is the normalized trigram frequency vector of a language
+type trigramProfile map[string]float64
+
+// trigramProfiles are built once from the language samples
+var trigramProfiles = func() map[string]trigramProfile {
+	profiles := make(map[string]trigramProfile, len(languageSamples))
+	for language, sample := range languageSamples {
+		profiles[language] = trigrams(sample)
+	}
+	return profiles
+}()
+
+// trigrams counts the letter trigrams of text, with words padded by
+// spaces, and normalizes the counts to a unit vector.
+func trigrams(text string) trigramProfile {
+	profile := make(trigramProfile)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			profile[string(runes[i:i+3])]++
+		}
+	}
+
+	var norm float64
+	for _, n := range profile {
+		norm += n * n
+	}
+	norm = math.Sqrt(norm)
+	for gram := range profile {
+		profile[gram] /= norm
+	}
+	return profile
+}
+
+// identifyLatin returns the Latin-script language whose trigram profile is
+// closest (by cosine similarity) to the text.
+func identifyLatin(text string) string {
+	profile := trigrams(text)
+	best, bestScore := "und", 0.0
+	for _, language := range sortedKeys(trigramProfiles) {
+		var score float64
+		for gram, weight := range profile {
+			score += weight * trigramProfiles[language][gram]
+		}
+		if score > bestScore {
+			best, bestScore = language, score
+		}
+	}
+	return best
+}
+
+// identifySegment names the language of a segment from its script, or from
+// its trigrams for Latin text. CJK runs with kana are Japanese.
+func identifySegment(segment ScriptSegment) string {
+	switch segment.Script {
+	case "Latin":
+		if segment.Letters < minSegmentLetters {
+			return "und"
+		}
+		return identifyLatin(segment.Text)
+	case "CJK":
+		for _, r := range segment.Text {
+			if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+				return "ja"
+			}
+		}
+		return "zh"
+	}
+	if language, ok := scriptLanguages[segment.Script]; ok {
+		return language
+	}
+	return "und"
+}
+
+// LanguageShare is the share of a response's letters in one language
+type LanguageShare struct {
+	Language string  `json:"language"`
+	Share    float64 `json:"share"`
+}
+
+// LanguageReport holds the detected languages and script proportions of a
+// response. Shares are fractions of its letters.
+type LanguageReport struct {
+	Languages []LanguageShare    `json:"languages"`
+	Scripts   map[string]float64 `json:"scripts"`
+	Segments  []ScriptSegment    `json:"-"`
+}
+
+// AnalyzeLanguage identifies the language of every script segment of text
+// and sums the letters per language and per script.
+func AnalyzeLanguage(text string) *LanguageReport {
+	report := &LanguageReport{Scripts: make(map[string]float64)}
+
+	letters := 0
+	for _, r := range text {
+		if script := scriptOf(r); script != "" {
+			report.Scripts[script]++
+			letters++
+		}
+	}
+	if letters == 0 {
+		return report
+	}
+	for script := range report.Scripts {
+		report.Scripts[script] /= float64(letters)
+	}
+
+	languages := make(map[string]int)
+	for _, segment := range ScriptSegments(text) {
+		segment.Language = identifySegment(segment)
+		report.Segments = append(report.Segments, segment)
+		languages[segment.Language] += segment.Letters
+	}
+	for language, n := range languages {
+		report.Languages = append(report.Languages, LanguageShare{Language: language, Share: float64(n) / float64(letters)})
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		if report.Languages[i].Share != report.Languages[j].Share {
+			return report.Languages[i].Share > report.Languages[j].Share
+		}
+		return report.Languages[i].Language < report.Languages[j].Language
+	})
+
+	return report
+}
+
+// Main returns the language with the largest share, ignoring undetermined
+// segments, or "und".
+func (r *LanguageReport) Main() string {
+	for _, l := range r.Languages {
+		if l.Language != "und" {
+			return l.Language
+		}
+	}
+	return "und"
+}
+
+// Share returns the share of a language in the report
+func (r *LanguageReport) Share(language string) float64 {
+	for _, l := range r.Languages {
+		if l.Language == language {
+			return l.Share
+		}
+	}
+	return 0
+}
+
+// ScriptShare returns the share of a script, or of every script of an
+// alias such as "Japanese".
+func (r *LanguageReport) ScriptShare(script string) float64 {
+	scripts, ok := scriptAliases[script]
+	if !ok {
+		scripts = []string{script}
+	}
+	var share float64
+	for _, s := range scripts {
+		share += r.Scripts[s]
+	}
+	return share
+}
+
+// String summarizes the report on one line
+func (r *LanguageReport) String() string {
+	var languages, scripts []string
+	for _, l := range r.Languages {
+		languages = append(languages, fmt.Sprintf("%s %.0f%%", l.Language, 100*l.Share))
+	}
+	for _, script := range sortedKeys(r.Scripts) {
+		scripts = append(scripts, fmt.Sprintf("%s %.0f%%", script, 100*r.Scripts[script]))
+	}
+	return fmt.Sprintf("languages: %s; scripts: %s", strings.Join(languages, ", "), strings.Join(scripts, ", "))
+}
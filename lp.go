@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// LPConstraint is a linear inequality: the sum of Coefficients[i] times
+// variable i is at most Bound.
+type LPConstraint struct {
+	Coefficients []string
+	Bound        string
+}
+
+// LinearProgram maximizes a linear objective over non-negative variables
+// subject to ≤ constraints with non-negative bounds, which covers the
+// production-planning problems used in prompts. Coefficients are rational
+// literals ("40", "2.5", "1/3") so the optimum is computed exactly.
+type LinearProgram struct {
+	Variables   []string
+	Objective   []string
+	Constraints []LPConstraint
+}
+
+// Solve runs the simplex method on exact rationals with Bland's rule, which
+// cannot cycle, and returns the optimal variable values and objective.
+func (lp LinearProgram) Solve() ([]*big.Rat, *big.Rat, error) {
+	n, m := len(lp.Variables), len(lp.Constraints)
+	if len(lp.Objective) != n {
+		return nil, nil, fmt.Errorf("objective has %d coefficients for %d variables", len(lp.Objective), n)
+	}
+
+	// Tableau rows are the constraints with one slack column each, plus the
+	// right-hand side; the last row holds the negated objective.
+	width := n + m + 1
+	tableau := make([][]*big.Rat, m+1)
+	for i := range tableau {
+		tableau[i] = make([]*big.Rat, width)
+		for j := range tableau[i] {
+			tableau[i][j] = new(big.Rat)
+		}
+	}
+
+	basis := make([]int, m)
+	for i, constraint := range lp.Constraints {
+		if len(constraint.Coefficients) != n {
+			return nil, nil, fmt.Errorf("constraint %d has %d coefficients for %d variables", i+1, len(constraint.Coefficients), n)
+		}
+		for j, literal := range constraint.Coefficients {
+			if _, ok := tableau[i][j].SetString(literal); !ok {
+				return nil, nil, fmt.Errorf("invalid coefficient %q", literal)
+			}
+		}
+		if _, ok := tableau[i][width-1].SetString(constraint.Bound); !ok {
+			return nil, nil, fmt.Errorf("invalid bound %q", constraint.Bound)
+		}
+		if tableau[i][width-1].Sign() < 0 {
+			return nil, nil, fmt.Errorf("constraint %d has a negative bound", i+1)
+		}
+		tableau[i][n+i].SetInt64(1)
+		basis[i] = n + i
+	}
+	for j, literal := range lp.Objective {
+		if _, ok := tableau[m][j].SetString(literal); !ok {
+			return nil, nil, fmt.Errorf("invalid coefficient %q", literal)
+		}
+		tableau[m][j].Neg(tableau[m][j])
+	}
+
+	for {
+		// Entering column: the first with a negative reduced cost
+		enter := -1
+		for j := 0; j < width-1; j++ {
+			if tableau[m][j].Sign() < 0 {
+				enter = j
+				break
+			}
+		}
+		if enter < 0 {
+			break
+		}
+
+		// Leaving row: minimum ratio, ties broken by the lowest basic column
+		leave := -1
+		var best *big.Rat
+		for i := 0; i < m; i++ {
+			if tableau[i][enter].Sign() <= 0 {
+				continue
+			}
+			ratio := new(big.Rat).Quo(tableau[i][width-1], tableau[i][enter])
+			if c := cmpRat(ratio, best); leave < 0 || c < 0 || (c == 0 && basis[i] < basis[leave]) {
+				leave, best = i, ratio
+			}
+		}
+		if leave < 0 {
+			return nil, nil, fmt.Errorf("objective is unbounded")
+		}
+
+		pivot := new(big.Rat).Set(tableau[leave][enter])
+		for j := range tableau[leave] {
+			tableau[leave][j].Quo(tableau[leave][j], pivot)
+		}
+		for i := range tableau {
+			if i == leave || tableau[i][enter].Sign() == 0 {
+				continue
+			}
+			factor := new(big.Rat).Set(tableau[i][enter])
+			for j := range tableau[i] {
+				tableau[i][j].Sub(tableau[i][j], new(big.Rat).Mul(factor, tableau[leave][j]))
+			}
+		}
+		basis[leave] = enter
+	}
+
+	values := make([]*big.Rat, n)
+	for j := range values {
+		values[j] = new(big.Rat)
+	}
+	for i, column := range basis {
+		if column < n {
+			values[column].Set(tableau[i][width-1])
+		}
+	}
+
+	return values, tableau[m][width-1], nil
+}
+
+func cmpRat(a, b *big.Rat) int {
+	if b == nil {
+		return -1
+	}
+	return a.Cmp(b)
+}
+
+// LPGrader derives the reference answer of an LP-style prompt by solving
+// its program, then checks that the response states the optimal value of
+// every variable and the optimal objective.
+type LPGrader struct {
+	Program LinearProgram
+	// ObjectiveLabel names the objective in details (default "objective")
+	ObjectiveLabel string
+}
+
+func (g LPGrader) Name() string { return "lp" }
+
+func (g LPGrader) Grade(response string) *Grade {
+	values, optimum, err := g.Program.Solve()
+	if err != nil {
+		return &Grade{Grader: g.Name(), Verdict: VerdictWrongValue, Details: "invalid program: " + err.Error()}
+	}
+
+	label := g.ObjectiveLabel
+	if label == "" {
+		label = "objective"
+	}
+	grade := ExactGrader{
+		Answers: append(values, optimum),
+		Labels:  append(append([]string{}, g.Program.Variables...), label),
+	}.Grade(response)
+	grade.Grader = g.Name()
+
+	return grade
+}
+
+// Extract returns the last number of the response, normalized to the
+// optimal value it denotes
+func (g LPGrader) Extract(response string) string {
+	values, optimum, err := g.Program.Solve()
+	if err != nil {
+		return ""
+	}
+	return ExactGrader{Answers: append(values, optimum)}.Extract(response)
+}
+
+// Correct reports whether an extracted answer is the optimal objective
+func (g LPGrader) Correct(answer string) bool {
+	_, optimum, err := g.Program.Solve()
+	return err == nil && answer == optimum.RatString()
+}
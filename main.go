@@ -5,39 +5,159 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/parakeet-nest/parakeet/completion"
-	"github.com/parakeet-nest/parakeet/llm"
 )
 
-// ResponseMetrics holds the basic metrics for each test response
+// ResponseMetrics holds the basic metrics for each test response.
+// CharCount counts Unicode code points and GraphemeCount user-perceived
+// characters; token counts come from the server.
 type ResponseMetrics struct {
-	ResponseTime time.Duration `json:"responseTime"`
-	CharCount    int           `json:"charCount"`
-	WordCount    int           `json:"wordCount"`
+	ResponseTime   time.Duration `json:"responseTime"`
+	CharCount      int           `json:"charCount"`
+	ByteCount      int           `json:"byteCount"`
+	GraphemeCount  int           `json:"graphemeCount"`
+	WordCount      int           `json:"wordCount"`
+	SentenceCount  int           `json:"sentenceCount"`
+	ParagraphCount int           `json:"paragraphCount"`
+
+	PromptTokens    int          `json:"promptTokens,omitempty"`
+	ResponseTokens  int          `json:"responseTokens,omitempty"`
+	TokensPerSecond float64      `json:"tokensPerSecond,omitempty"`
+	Readability     *Readability `json:"readability,omitempty"`
 }
 
 // TestResult combines the test configuration, prompt, response, and metrics
 type TestResult struct {
-	Config    ConfigKey       `json:"config"`
-	Prompt    PromptKey       `json:"prompt"`
-	Response  string          `json:"response"`
-	Metrics   ResponseMetrics `json:"metrics"`
-	Timestamp time.Time       `json:"timestamp"`
+	Config   ConfigKey       `json:"config"`
+	Prompt   PromptKey       `json:"prompt"`
+	Response string          `json:"response"`
+	Metrics  ResponseMetrics `json:"metrics"`
+	// Trial numbers the samples of a cell from 1 when -trials is above 1
+	Trial int `json:"trial,omitempty"`
+	// Options are the effective options sent to the server
+	Options map[string]interface{} `json:"options,omitempty"`
+	// DoneReason is why generation ended: stop, length or cancelled
+	DoneReason string    `json:"doneReason,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+
+	Structured *StructuredResult `json:"structured,omitempty"`
+	Tools      *ToolResult       `json:"tools,omitempty"`
+	Grade      *Grade            `json:"grade,omitempty"`
+	FIM        *FIMResult        `json:"fim,omitempty"`
+	RAG        *RAGResult        `json:"rag,omitempty"`
+	Instance   *PromptInstance   `json:"instance,omitempty"`
+
+	Constraints []ConstraintResult `json:"constraints,omitempty"`
+	Language    *LanguageReport    `json:"language,omitempty"`
+
+	Degeneration *Degeneration `json:"degeneration,omitempty"`
+	Stop         *StopResult   `json:"stop,omitempty"`
+}
+
+// RunOptions holds the settings shared by every test of a run
+type RunOptions struct {
+	URL        string
+	Model      string
+	SchemaMode SchemaMode
+	RAG        RAGOptions
+	Seed       int64
+	Instances  int
+	// SeedSampling sends SampleSeed as the sampling seed of every request.
+	// Trial n of a cell uses SampleSeed+n-1, so trials stay independent
+	// samples, unless SameSampleSeed keeps every trial on SampleSeed.
+	SampleSeed     int64
+	SeedSampling   bool
+	SameSampleSeed bool
+	Trials         int
+	Print          bool
+	Stream         bool
+	Watchdog       bool
+
+	// Instance is the generated variant being run, for generated prompts
+	Instance *PromptInstance
+}
+
+// Commands select what the tool does; CommandRun runs prompt tests
+const (
+	CommandRun    = "run"
+	CommandEmbed  = "embed"
+	CommandNeedle = "needle"
+	// CommandDeterminism runs every cell twice with the same seed
+	CommandDeterminism = "determinism"
+	// CommandConfigs lists the presets or shows one with its options
+	CommandConfigs = "configs"
+	// CommandAblate perturbs the options of a preset one at a time
+	CommandAblate = "ablate"
+	// CommandOptimize searches the options of a preset for the best score
+	CommandOptimize = "optimize"
+	// CommandRace eliminates the weakest configs by successive halving
+	CommandRace = "race"
+)
+
+var commands = map[string]bool{
+	CommandRun:         true,
+	CommandEmbed:       true,
+	CommandNeedle:      true,
+	CommandDeterminism: true,
+	CommandConfigs:     true,
+	CommandAblate:      true,
+	CommandOptimize:    true,
+	CommandRace:        true,
 }
 
 // Flags holds the program's command line flags
 type Flags struct {
-	ExportJSON   bool
-	PrintResults bool
-	URL          string
-	Model        string
-	Patterns     string
-	Configs      string
-	Prompts      string
-	Help         bool
+	Command string
+	Args    []string
+
+	ExportJSON    bool
+	PrintResults  bool
+	URL           string
+	Model         string
+	Patterns      string
+	Configs       string
+	Prompts       string
+	SchemaMode    string
+	FIM           string
+	FIMSpans      string
+	FIMSamples    int
+	EmbedModels   string
+	Corpus        string
+	K             int
+	RAGChunks     string
+	RAGK          string
+	RAGEmbed      string
+	NeedleLens    string
+	NeedleDepths  string
+	NumCtx        string
+	Seed          int64
+	SampleSeed    int64
+	SampleSeedSet bool
+	Instances     int
+	Trials        int
+	DivEmbed      string
+	Vote          string
+	Suite         string
+	Set           SetFlag
+	JudgeModel    string
+	AblateBase    string
+	AblateOpts    string
+	OptBase       string
+	OptSpace      string
+	Budget        int
+	Study         string
+	LatencyWt     float64
+	OptName       string
+	OptOut        string
+	RaceStart     int
+	RaceDrop      float64
+	Fold          int
+	Split         string
+	Stream        bool
+	Watchdog      bool
+	Help          bool
 }
 
 const helpText = `SML Testing Tool
@@ -46,7 +166,22 @@ A comprehensive testing tool for evaluating Small Language Models (SLMs) across
 different configurations and prompt patterns.
 
 Usage:
-  go run . [flags]
+  go run . [command] [flags]
+
+Commands:
+  run           Run prompt tests (default)
+  embed         Benchmark embedding models on a labeled corpus
+  needle        Needle-in-a-haystack recall across context lengths
+  determinism   Run every cell twice with the same seed and compare outputs
+  configs       List the presets; "configs show NAME" renders one with
+                every Ollama option, its source, range and description
+  ablate        Perturb the options of a preset one at a time and report
+                the sensitivity of each pattern to them
+  optimize      Search the options of a preset for the best score with a
+                Parzen estimator; the study resumes and the best trial is
+                saved as a preset
+  race          Eliminate the weakest configs by successive halving on
+                growing prompt subsets
 
 Flags:
   Output Control:
@@ -63,10 +198,107 @@ Flags:
     
     -configs      Comma-separated list of model configurations
                  Available: %s
+
+    -suite        JSON suite file adding presets; a preset may extend a
+                 built-in or suite preset and override its options
+    -set          Override an option of every config, e.g.
+                 -set temperature=0.1 (repeatable; lists use "|")
     
     -prompts      Comma-separated list of specific prompts to test
                  Available: %s
 
+    -schema-mode  How JSON Schemas reach the model: "format" sends them
+                 through Ollama's format parameter, "prompt" appends them
+                 to the prompt text (default: "format")
+
+  Fill-in-the-middle:
+    -fim          Comma-separated list of .go/.py source files to mask and
+                 complete through Ollama's suffix parameter
+    -fim-spans    Span kinds to mask: line, block, function
+                 (default: "line,block,function")
+    -fim-samples  Spans masked per kind and file (default: 3)
+
+  Generated prompts:
+    -seed         Seed for generated prompt instances (default: 1)
+    -sample-seed  Sampling seed sent with every request when given; trial n
+                 of a cell uses sample-seed+n-1 (default: 1, used by the
+                 determinism command for both runs)
+    -instances    Instances run per generated prompt (default: 10)
+
+  Trials:
+    -trials       Samples run per prompt, config and cell (default: 1); above
+                 1, the diversity of each cell's samples is reported
+    -diversity-embed-model
+                 Embedding model for the pairwise distance of samples
+                 (default: "nomic-embed-text"; empty skips it)
+
+  Self-consistency:
+    -vote         Pick one answer out of the trials of each graded cell:
+                 "majority" votes on the answers extracted by the grader,
+                 "judge" asks a model for the best trial (needs -trials)
+    -judge-model  Model used by -vote=judge (default: the -model value)
+
+  Ablation:
+    -ablate-base  Preset the ablate command starts from
+                 (default: "Analytical")
+    -ablate-options
+                 Comma-separated options to ablate, each with optional
+                 values, e.g. "temperature=0|0.5|1,top_p" (default:
+                 "temperature,top_k,top_p,repeat_penalty,presence_penalty")
+
+  Optimization:
+    -optimize-base
+                 Preset the optimize command starts from
+                 (default: "Analytical")
+    -optimize-space
+                 Comma-separated options to search, each with an optional
+                 range, e.g. "temperature=0:1.5,top_k" (default:
+                 "temperature,top_k,top_p,min_p,repeat_penalty,presence_penalty")
+    -budget       Trials in the study, including resumed ones (default: 20)
+    -study        Study file saved after every trial and resumed
+                 (default: "study.json")
+    -latency-weight
+                 Objective penalty per second of mean latency (default: 0)
+    -optimize-name
+                 Name of the saved preset (default: base + "-Tuned")
+    -optimize-out Suite file the preset is added to
+                 (default: "suites/optimized.json")
+
+  Racing:
+    -race-start   Prompts every config runs in the first round (default: 2)
+    -race-drop    Fraction of configs eliminated after each round
+                 (default: 0.5)
+
+  Prompt splits:
+    -fold         Held-out fold of a k-fold suite split (default: the
+                 suite's); ablate, optimize and race tune on the other
+                 folds and report the dev-test gap on this one
+    -split        Run only the "dev" or "test" prompts of the suite split
+
+  Streaming:
+    -stream       Stream generations from the server
+    -watchdog     Abort streamed generations once they loop and mark the
+                 result degenerate (implies -stream)
+
+  Retrieval-augmented QA:
+    -rag-chunks   Comma-separated chunk sizes in words to sweep (default: 80)
+    -rag-k        Comma-separated numbers of retrieved passages to sweep (default: 3)
+    -rag-embed-model
+                 Embedding model used for retrieval (default: "nomic-embed-text")
+
+  Embeddings (embed command):
+    -embed-models Comma-separated list of embedding models to compare
+                 (default: the -model value)
+    -corpus       Labeled corpus and query set (default: "corpora/embed.json")
+    -k            Cutoff for recall@k and nDCG@k (default: 5)
+
+  Needle in a haystack (needle command):
+    -needle-lengths Comma-separated haystack lengths in approximate tokens
+                 (default: "1000,2000,4000")
+    -needle-depths  Comma-separated needle depths in percent
+                 (default: "0,25,50,75,100")
+    -num-ctx      Comma-separated num_ctx values to sweep (default: "2048,8192")
+
   Utility:
     -help        Display this help message
 
@@ -85,6 +317,72 @@ Examples:
 
   # Export results to JSON
   go run . -patterns=technical -export
+
+  # Validate structured JSON output with the schema given in the prompt
+  go run . -patterns=structured -schema-mode=prompt
+
+  # Evaluate tool calling against the mock tools
+  go run . -patterns=tools -model=qwen2.5:1.5b
+
+  # Grade the generated SQL by running it against the fixture database
+  go run . -prompts=conversion
+
+  # Compile generated Go code and run it against hidden tests
+  go run . -patterns=code
+
+  # Benchmark a vision model on the image prompts
+  go run . -patterns=vision -model=moondream
+
+  # Fill-in-the-middle completion on local source files
+  go run . -model=qwen2.5-coder:1.5b -fim=main.go,patterns.go -fim-spans=block,function
+
+  # Check verifiable instructions across configs
+  go run . -patterns=instructions -print=false
+
+  # Accuracy over 200 generated variants of each arithmetic prompt
+  go run . -prompts=gen_clock_angle,gen_dice -configs=Ultra-Precise -instances=200 -seed=7 -print=false
+
+  # Diversity/quality trade-off of two creative presets over 8 samples
+  go run . -patterns=creative -configs=Creative-High,Mirostat2-Dynamic -trials=8 -print=false
+
+  # Majority vote over 5 samples against single-sample accuracy
+  go run . -prompts=math_logic,seeker -configs=Creative-High -trials=5 -vote=majority
+
+  # Check which configs reproduce byte-identical output with a fixed seed
+  go run . determinism -patterns=math -sample-seed=42
+
+  # Analytical, but with temperature 0.1
+  go run . -configs=Analytical -set temperature=0.1 -patterns=math
+
+  # Presets from a suite file
+  go run . -suite=suites/tuning.json -configs=Analytical-Cold,Analytical-Long
+
+  # Sensitivity of the math prompts to the options of Analytical
+  go run . ablate -patterns=math -ablate-options=temperature,top_p -trials=2 -print=false
+
+  # Search the sampling options of Analytical for the best math score
+  go run . optimize -patterns=math -budget=30 -print=false
+
+  # Race every preset on the graded math and science prompts
+  go run . race -patterns=math,science,game-theory -print=false
+
+  # Race on the dev prompts of fold 2, then report the winner on fold 2
+  go run . race -suite=suites/holdout.json -fold=2 -patterns=math,science -print=false
+
+  # Resolved options of a preset, with defaults
+  go run . configs show Analytical
+
+  # Cut off looping generations at a low repeat penalty
+  go run . -patterns=language -configs=Creative-High -watchdog
+
+  # Sweep chunk size and k on the RAG prompts
+  go run . -patterns=rag -configs=Ultra-Precise -rag-chunks=40,120 -rag-k=1,3
+
+  # Compare embedding models on the sample corpus
+  go run . embed -embed-models=nomic-embed-text,all-minilm -k=3
+
+  # Long-context recall heatmap
+  go run . needle -needle-lengths=2000,6000 -num-ctx=4096,8192
 `
 
 func toStrings[T ~string](items []T) []string {
@@ -105,7 +403,44 @@ func parseFlags() *Flags {
 	flag.StringVar(&flags.Model, "model", "deepseek-r1:1.5b", "Model name")
 	flag.StringVar(&flags.Patterns, "patterns", "", "Comma-separated list of test patterns")
 	flag.StringVar(&flags.Configs, "configs", "", "Comma-separated list of configurations")
+	flag.StringVar(&flags.Suite, "suite", "", "JSON suite file adding presets that may extend others")
+	flag.Var(&flags.Set, "set", "Override an option of every config, e.g. temperature=0.1 (repeatable)")
 	flag.StringVar(&flags.Prompts, "prompts", "", "Comma-separated list of specific prompts")
+	flag.StringVar(&flags.SchemaMode, "schema-mode", string(SchemaModeFormat), "How JSON Schemas are sent: format or prompt")
+	flag.StringVar(&flags.FIM, "fim", "", "Comma-separated list of source files for fill-in-the-middle tests")
+	flag.StringVar(&flags.FIMSpans, "fim-spans", "line,block,function", "Span kinds to mask for fill-in-the-middle tests")
+	flag.IntVar(&flags.FIMSamples, "fim-samples", 3, "Spans masked per kind and file")
+	flag.StringVar(&flags.EmbedModels, "embed-models", "", "Comma-separated list of embedding models")
+	flag.StringVar(&flags.Corpus, "corpus", "corpora/embed.json", "Labeled corpus and query set for embeddings")
+	flag.IntVar(&flags.K, "k", 5, "Cutoff for recall@k and nDCG@k")
+	flag.StringVar(&flags.RAGChunks, "rag-chunks", strconv.Itoa(defaultRAGChunkSize), "Comma-separated chunk sizes in words for RAG prompts")
+	flag.StringVar(&flags.RAGK, "rag-k", strconv.Itoa(defaultRAGK), "Comma-separated numbers of passages retrieved for RAG prompts")
+	flag.StringVar(&flags.RAGEmbed, "rag-embed-model", defaultRAGEmbedModel, "Embedding model used to retrieve passages")
+	flag.Int64Var(&flags.Seed, "seed", defaultSeed, "Seed for generated prompt instances")
+	flag.Int64Var(&flags.SampleSeed, "sample-seed", defaultSeed, "Sampling seed of every request when set; trial n uses sample-seed+n-1")
+	flag.IntVar(&flags.Instances, "instances", defaultInstances, "Instances run per generated prompt")
+	flag.IntVar(&flags.Trials, "trials", 1, "Samples run per prompt, config and cell")
+	flag.StringVar(&flags.DivEmbed, "diversity-embed-model", defaultRAGEmbedModel, "Embedding model for the pairwise distance of trials (empty: skip)")
+	flag.StringVar(&flags.Vote, "vote", "", "Self-consistency over the trials of graded cells: majority or judge")
+	flag.StringVar(&flags.JudgeModel, "judge-model", "", "Model picking the best trial with -vote=judge (default: -model)")
+	flag.StringVar(&flags.AblateBase, "ablate-base", string(ConfigAnalytical), "Preset the ablate command starts from")
+	flag.StringVar(&flags.AblateOpts, "ablate-options", DefaultAblateOptions, "Comma-separated options to ablate, each with optional values, e.g. temperature=0|0.5|1")
+	flag.StringVar(&flags.OptBase, "optimize-base", string(ConfigAnalytical), "Preset the optimize command starts from")
+	flag.StringVar(&flags.OptSpace, "optimize-space", DefaultSearchSpace, "Comma-separated options to search, each with an optional range, e.g. temperature=0:1.5")
+	flag.IntVar(&flags.Budget, "budget", 20, "Trials run by the optimize command, including resumed ones")
+	flag.StringVar(&flags.Study, "study", "study.json", "Study file the optimize command saves and resumes")
+	flag.Float64Var(&flags.LatencyWt, "latency-weight", 0, "Objective penalty per second of mean latency")
+	flag.StringVar(&flags.OptName, "optimize-name", "", "Name of the preset saved from the best trial (default: base + \"-Tuned\")")
+	flag.StringVar(&flags.OptOut, "optimize-out", "suites/optimized.json", "Suite file the best preset is added to")
+	flag.IntVar(&flags.RaceStart, "race-start", 2, "Prompts every config runs in the first round of a race")
+	flag.Float64Var(&flags.RaceDrop, "race-drop", 0.5, "Fraction of configs eliminated after each round of a race")
+	flag.IntVar(&flags.Fold, "fold", 0, "Held-out fold of a k-fold suite split (default: the suite's)")
+	flag.StringVar(&flags.Split, "split", "", "Run only the dev or test prompts of the suite split")
+	flag.BoolVar(&flags.Stream, "stream", false, "Stream generations from the server")
+	flag.BoolVar(&flags.Watchdog, "watchdog", false, "Abort streamed generations that start looping (implies -stream)")
+	flag.StringVar(&flags.NeedleLens, "needle-lengths", "1000,2000,4000", "Comma-separated haystack lengths in approximate tokens")
+	flag.StringVar(&flags.NeedleDepths, "needle-depths", "0,25,50,75,100", "Comma-separated needle depths in percent")
+	flag.StringVar(&flags.NumCtx, "num-ctx", "2048,8192", "Comma-separated num_ctx values for the needle command")
 
 	// Custom usage message
 	flag.Usage = func() {
@@ -115,7 +450,26 @@ func parseFlags() *Flags {
 		fmt.Printf(helpText, patterns, configs, prompts)
 	}
 
-	flag.Parse()
+	// The command may come first (go run . embed -k=3) or after the flags
+	args := os.Args[1:]
+	if len(args) > 0 && commands[args[0]] {
+		flags.Command = args[0]
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	flags.Args = flag.Args()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "sample-seed" {
+			flags.SampleSeedSet = true
+		}
+	})
+	if flags.Command == "" && len(flags.Args) > 0 && commands[flags.Args[0]] {
+		flags.Command = flags.Args[0]
+		flags.Args = flags.Args[1:]
+	}
+	if flags.Command == "" {
+		flags.Command = CommandRun
+	}
 
 	if flags.Help {
 		flag.Usage()
@@ -126,33 +480,101 @@ func parseFlags() *Flags {
 }
 
 // TestLLM runs a single test with the specified configuration
-func TestLLM(url, model string, promptKey PromptKey, configKey ConfigKey, config map[string]interface{}) (TestResult, error) {
+func TestLLM(opts RunOptions, promptKey PromptKey, configKey ConfigKey, config map[string]interface{}) (TestResult, error) {
 	// Start timing from the moment we begin processing
 	startTime := time.Now()
 
-	options := llm.SetOptions(config)
-	question := llm.GenQuery{
-		Model:   model,
+	spec := PromptSpecs[promptKey]
+	request := GenerateRequest{
+		Model:   opts.Model,
 		Prompt:  TestPrompts[promptKey],
-		Options: options,
+		Options: OllamaOptions(config),
 		System:  "You're a friendly and helpful assistant providing concise and accurate answers.",
 	}
+	if opts.SeedSampling {
+		request.Options["seed"] = opts.SampleSeed
+	}
+
+	if opts.Instance != nil {
+		request.Prompt = opts.Instance.Text
+		spec.Grader = opts.Instance.Grader
+	}
+
+	var ragResult *RAGResult
+	var ragChunks []RAGChunk
+	if len(spec.Documents) > 0 {
+		prompt, chunks, result, err := RetrievePrompt(opts.URL, opts.RAG.EmbedModel, request.Prompt, spec.Documents, opts.RAG.ChunkSize, opts.RAG.K)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("retrieval error: %v", err)
+		}
+		request.Prompt, ragChunks, ragResult = prompt, chunks, result
+
+		// Retrieval, including indexing on first use, is not response time
+		startTime = time.Now()
+	}
+
+	if len(spec.Images) > 0 {
+		images, err := LoadImages(spec.Images)
+		if err != nil {
+			return TestResult{}, err
+		}
+		request.Images = images
+	}
+
+	if len(spec.Schema) > 0 {
+		if opts.SchemaMode == SchemaModePrompt {
+			request.Prompt = schemaPrompt(request.Prompt, spec.Schema)
+		} else {
+			request.Format = spec.Schema
+		}
+	}
 
 	// Generate response and measure total time including network and processing
-	answer, err := completion.Generate(url, question)
-	if err != nil {
-		return TestResult{}, fmt.Errorf("generation error: %v", err)
+	var answer GenerateResponse
+	var toolResult *ToolResult
+	var watchdog *Watchdog
+	if len(spec.Tools) > 0 {
+		// Tool tests go through /api/chat, the only endpoint that accepts tools
+		chat := ChatRequest{
+			Model:   request.Model,
+			Options: request.Options,
+			Messages: []ChatMessage{
+				{Role: "system", Content: request.System},
+				{Role: "user", Content: request.Prompt},
+			},
+		}
+		reply, result, err := RunToolChat(opts.URL, chat, spec)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("generation error: %v", err)
+		}
+		answer.Response = reply.Message.Content
+		answer.PromptEvalCount, answer.EvalCount, answer.EvalDuration = reply.PromptEvalCount, reply.EvalCount, reply.EvalDuration
+		answer.DoneReason = reply.DoneReason
+		toolResult = result
+	} else if opts.Stream || opts.Watchdog {
+		onChunk := func(string) bool { return true }
+		if opts.Watchdog {
+			watchdog = &Watchdog{}
+			onChunk = watchdog.Feed
+		}
+		var err error
+		answer, err = GenerateStream(opts.URL, request, onChunk)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("generation error: %v", err)
+		}
+	} else {
+		var err error
+		answer, err = Generate(opts.URL, request)
+		if err != nil {
+			return TestResult{}, fmt.Errorf("generation error: %v", err)
+		}
 	}
 
 	// Calculate metrics
 	endTime := time.Now()
 	responseTime := endTime.Sub(startTime)
 
-	metrics := ResponseMetrics{
-		ResponseTime: responseTime,
-		CharCount:    len(answer.Response),
-		WordCount:    len(strings.Fields(answer.Response)),
-	}
+	metrics := MeasureResponse(answer.Response, responseTime, answer.PromptEvalCount, answer.EvalCount, answer.EvalDuration)
 
 	result := TestResult{
 		Config:    configKey,
@@ -160,38 +582,379 @@ func TestLLM(url, model string, promptKey PromptKey, configKey ConfigKey, config
 		Response:  answer.Response,
 		Metrics:   metrics,
 		Timestamp: endTime,
+		Tools:     toolResult,
+
+		Options:    request.Options,
+		DoneReason: answer.DoneReason,
+		Stop:       CheckStop(StopSequences(config), answer.Response, answer.DoneReason),
+		RAG:        ragResult,
+		Instance:   opts.Instance,
+		Language:   AnalyzeLanguage(answer.Response),
+
+		Degeneration: AnalyzeDegeneration(answer.Response),
+	}
+
+	if watchdog != nil && watchdog.Reason != "" {
+		result.Degeneration.Degenerate = true
+		result.Degeneration.Aborted = true
+		result.Degeneration.Reason = "aborted: " + watchdog.Reason
+	}
+
+	if ragResult != nil {
+		GradeGrounding(ragResult, answer.Response, ragChunks)
+	}
+
+	if len(spec.Schema) > 0 || spec.Expected != nil {
+		result.Structured = ValidateStructured(answer.Response, spec.Schema, spec.Expected)
+	}
+
+	if spec.Grader != nil {
+		result.Grade = spec.Grader.Grade(answer.Response)
+	}
+
+	if len(spec.Constraints) > 0 {
+		result.Constraints = CheckConstraints(spec.Constraints, answer.Response)
 	}
 
 	return result, nil
 }
 
 // RunTestPattern executes all tests in a pattern and collects results
-func RunTestPattern(url, model string, pattern TestPattern, shouldPrint bool) ([]TestResult, error) {
+func RunTestPattern(opts RunOptions, pattern TestPattern) ([]TestResult, error) {
 	results := make([]TestResult, 0)
 
 	for _, prompt := range pattern.prompts {
+		// Prompts backed by documents run once per chunk size and k
+		cells := []RAGOptions{opts.RAG}
+		if len(PromptSpecs[prompt].Documents) > 0 {
+			cells = nil
+			for _, size := range opts.RAG.ChunkSizes {
+				for _, k := range opts.RAG.Ks {
+					cell := opts.RAG
+					cell.ChunkSize, cell.K = size, k
+					cells = append(cells, cell)
+				}
+			}
+		}
+
+		// Generated prompts run once per instance
+		instances := []*PromptInstance{nil}
+		if generate := PromptSpecs[prompt].Generate; generate != nil {
+			instances = nil
+			for _, instance := range GenerateInstances(prompt, generate, opts.Seed, opts.Instances) {
+				instances = append(instances, &instance)
+			}
+		}
+
 		for _, config := range pattern.configs {
-			fmt.Printf("🤖 Running '%s' with %s configuration:\n", prompt, config)
+			for _, cell := range cells {
+				for _, instance := range instances {
+					for trial := 1; trial <= max(opts.Trials, 1); trial++ {
+						cellOpts := opts
+						cellOpts.RAG = cell
+						cellOpts.Instance = instance
+						if !opts.SameSampleSeed {
+							cellOpts.SampleSeed += int64(trial - 1)
+						}
+						label := ""
+						if opts.Trials > 1 {
+							label = fmt.Sprintf(" [trial %d/%d]", trial, opts.Trials)
+						}
+						switch {
+						case instance != nil:
+							fmt.Printf("🤖 Running '%s' #%d with %s configuration%s:\n", prompt, instance.Index, config, label)
+						case cell.K > 0:
+							fmt.Printf("🤖 Running '%s' with %s configuration (chunk=%d, k=%d)%s:\n", prompt, config, cell.ChunkSize, cell.K, label)
+						default:
+							fmt.Printf("🤖 Running '%s' with %s configuration%s:\n", prompt, config, label)
+						}
+
+						result, err := TestLLM(cellOpts, prompt, config, Configs[config])
+						if err != nil {
+							fmt.Printf("Error testing prompt %s with config %s: %v\n", prompt, config, err)
+							continue
+						}
+						if opts.Trials > 1 {
+							result.Trial = trial
+						}
+
+						if opts.Print {
+							printResponse(result)
+						}
 
-			result, err := TestLLM(url, model, prompt, config, Configs[config])
-			if err != nil {
-				fmt.Printf("Error testing prompt %s with config %s: %v\n", prompt, config, err)
-				continue
+						results = append(results, result)
+					}
+				}
 			}
+		}
+	}
+
+	return results, nil
+}
+
+// runNeedle parses the needle grid flags and runs the needle command
+func runNeedle(flags *Flags, configs []ConfigKey) {
+	lengths, err := ParseIntList(flags.NeedleLens)
+	if err != nil {
+		fmt.Printf("Error parsing needle lengths: %v\n", err)
+		return
+	}
+	// Depth 0 is valid, so depths are parsed separately from the positive lists
+	var depths []int
+	for _, item := range strings.Split(flags.NeedleDepths, ",") {
+		depth, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || depth < 0 || depth > 100 {
+			fmt.Printf("Error parsing needle depths: invalid depth: %s\n", item)
+			return
+		}
+		depths = append(depths, depth)
+	}
+	numCtxs, err := ParseIntList(flags.NumCtx)
+	if err != nil {
+		fmt.Printf("Error parsing num_ctx values: %v\n", err)
+		return
+	}
+	if len(configs) == 0 {
+		configs = []ConfigKey{ConfigUltraPrecise}
+	}
+
+	results := RunNeedle(NeedleOptions{
+		URL:          flags.URL,
+		Model:        flags.Model,
+		Configs:      configs,
+		Lengths:      lengths,
+		Depths:       depths,
+		NumCtxs:      numCtxs,
+		Print:        flags.PrintResults,
+		SampleSeed:   flags.SampleSeed,
+		SeedSampling: flags.SampleSeedSet,
+	})
+
+	if flags.ExportJSON {
+		if err := ExportResults(results, "needle_results"); err != nil {
+			fmt.Printf("Error exporting results: %v\n", err)
+		}
+	}
+}
+
+// tuningPrompts keeps the dev prompts for a tuning command when a split is
+// set, returning the test prompts held out
+func tuningPrompts(split *Split, prompts []PromptKey) (dev, test []PromptKey, err error) {
+	if split == nil {
+		return prompts, nil, nil
+	}
+	dev, test = split.Partition(prompts)
+	if len(dev) == 0 {
+		return nil, nil, fmt.Errorf("every prompt is in the test split (%s)", split)
+	}
+	fmt.Printf("Tuning on %d dev prompts, holding out %d test prompts (%s)\n", len(dev), len(test), split)
+	return dev, test, nil
+}
 
-			if shouldPrint {
-				printResponse(result)
+// runHoldouts evaluates tuned configs on their test prompts, then exports
+// and prints the reports
+func runHoldouts(flags *Flags, opts RunOptions, split *Split, holdouts []Holdout) {
+	var reports []*HoldoutReport
+	for _, holdout := range holdouts {
+		report, err := RunHoldout(opts, split, holdout)
+		if err != nil {
+			fmt.Printf("Skipping holdout: %v\n", err)
+			continue
+		}
+		reports = append(reports, report)
+	}
+
+	if flags.ExportJSON && len(reports) > 0 {
+		if err := ExportResults(reports, "holdout_results"); err != nil {
+			fmt.Printf("Error exporting holdout: %v\n", err)
+		}
+	}
+	for _, report := range reports {
+		printHoldoutReport(report)
+	}
+}
+
+// runAblate ablates the options of a preset on each selected pattern, or
+// on the selected prompts together. With a split, each runs on its dev
+// prompts, and the base and the best scoring variant are then run on the
+// test prompts.
+func runAblate(flags *Flags, opts RunOptions, split *Split, prompts []PromptKey, patterns []PatternKey) {
+	options, err := ParseAblatedOptions(flags.AblateOpts)
+	if err != nil {
+		fmt.Printf("Error parsing ablate options: %v\n", err)
+		return
+	}
+
+	groups := make(map[string][]PromptKey)
+	var names []string
+	switch {
+	case len(prompts) > 0:
+		names = append(names, "custom")
+		groups["custom"] = prompts
+	case len(patterns) > 0:
+		for _, p := range patterns {
+			names = append(names, string(p))
+			groups[string(p)] = PatternMap[p](nil).prompts
+		}
+	default:
+		fmt.Println("Error: ablate needs -patterns or -prompts")
+		return
+	}
+
+	var reports []*AblationReport
+	var holdouts []Holdout
+	for _, name := range names {
+		dev, test, err := tuningPrompts(split, groups[name])
+		if err != nil {
+			fmt.Printf("Error ablating %s: %v\n", name, err)
+			return
+		}
+		report, err := RunAblation(opts, name, dev, ConfigKey(flags.AblateBase), options)
+		if err != nil {
+			fmt.Printf("Error ablating %s: %v\n", name, err)
+			return
+		}
+		reports = append(reports, report)
+
+		base := report.Options[0].Levels[0]
+		if _, ok := base.Means[MetricScore]; split == nil || !ok {
+			continue
+		}
+		best := base
+		for _, s := range report.Options {
+			for _, level := range s.Levels {
+				if level.Means[MetricScore] > best.Means[MetricScore] {
+					best = level
+				}
 			}
+		}
+		holdout := Holdout{Dev: dev, Test: test, Candidates: []HoldoutResult{
+			{Config: base.Config, DevScore: base.Means[MetricScore], DevRuns: base.Runs},
+		}}
+		if best.Config != base.Config {
+			holdout.Candidates = append(holdout.Candidates, HoldoutResult{Config: best.Config, DevScore: best.Means[MetricScore], DevRuns: best.Runs})
+		}
+		holdouts = append(holdouts, holdout)
+	}
 
-			results = append(results, result)
+	if flags.ExportJSON {
+		if err := ExportResults(reports, "ablation_results"); err != nil {
+			fmt.Printf("Error exporting results: %v\n", err)
 		}
 	}
+	for _, report := range reports {
+		printAblationReport(report)
+	}
+	runHoldouts(flags, opts, split, holdouts)
+}
 
-	return results, nil
+// runOptimize runs or resumes a study on the selected prompts and saves
+// the best trial as a preset. With a split, the study only sees the dev
+// prompts, and the base and the best trial are then run on the test
+// prompts.
+func runOptimize(flags *Flags, opts RunOptions, split *Split, prompts []PromptKey, selected bool) {
+	if !selected {
+		fmt.Println("Error: optimize needs -patterns or -prompts")
+		return
+	}
+	space, err := ParseSearchSpace(flags.OptSpace)
+	if err != nil {
+		fmt.Printf("Error parsing search space: %v\n", err)
+		return
+	}
+	dev, test, err := tuningPrompts(split, prompts)
+	if err != nil {
+		fmt.Printf("Error optimizing: %v\n", err)
+		return
+	}
+
+	study, err := RunOptimize(opts, flags.Study, flags.Budget, Study{
+		Base:          ConfigKey(flags.OptBase),
+		Model:         flags.Model,
+		Prompts:       dev,
+		Space:         space,
+		LatencyWeight: flags.LatencyWt,
+		Seed:          flags.Seed,
+	})
+	if err != nil {
+		fmt.Printf("Error optimizing: %v\n", err)
+		return
+	}
+	printStudySummary(study)
+
+	name := flags.OptName
+	if name == "" {
+		name = flags.OptBase + "-Tuned"
+	}
+	if err := SavePreset(study, flags.OptOut, name); err != nil {
+		fmt.Printf("Error saving preset: %v\n", err)
+		return
+	}
+	fmt.Printf("Saved the best trial as %s in %s (use -suite=%s -configs=%s)\n", name, flags.OptOut, flags.OptOut, name)
+
+	if split == nil {
+		return
+	}
+	best, ok := study.Best()
+	if !ok {
+		fmt.Println("Error: no completed trials to evaluate on the test split")
+		return
+	}
+	Configs[ConfigKey(name)] = study.Config(best.Params)
+	holdout := Holdout{Dev: study.Prompts, Test: test}
+	if base := study.Trials[0]; base.Runs > 0 {
+		// The dev score is that of trial 1, so the test split runs the
+		// same preset
+		key := study.Base
+		if study.BaseClamped() {
+			key = ConfigKey(fmt.Sprintf("%s[clamped]", study.Base))
+			Configs[key] = study.Config(base.Params)
+		}
+		holdout.Candidates = append(holdout.Candidates, HoldoutResult{Config: key, DevScore: base.Score, DevRuns: base.Runs})
+	}
+	holdout.Candidates = append(holdout.Candidates, HoldoutResult{Config: ConfigKey(name), DevScore: best.Score, DevRuns: best.Runs})
+	runHoldouts(flags, opts, split, []Holdout{holdout})
+}
+
+// runRace races the selected configs, or all of them, on the selected
+// prompts. With a split, the race only sees the dev prompts, and the
+// configs left in the last round are then run on the test prompts.
+func runRace(flags *Flags, opts RunOptions, split *Split, pattern TestPattern, selected bool) {
+	if !selected {
+		fmt.Println("Error: race needs -patterns or -prompts")
+		return
+	}
+	dev, test, err := tuningPrompts(split, pattern.prompts)
+	if err != nil {
+		fmt.Printf("Error racing configs: %v\n", err)
+		return
+	}
+	race, err := RunRace(opts, dev, pattern.configs, flags.RaceStart, flags.RaceDrop)
+	if err != nil {
+		fmt.Printf("Error racing configs: %v\n", err)
+		return
+	}
+	if flags.ExportJSON {
+		if err := ExportResults(race, "race_results"); err != nil {
+			fmt.Printf("Error exporting results: %v\n", err)
+		}
+	}
+	printRaceSummary(race)
+
+	if split == nil {
+		return
+	}
+	holdout := Holdout{Dev: race.Prompts, Test: test}
+	for _, s := range race.Rounds[len(race.Rounds)-1].Standings {
+		if !s.Eliminated {
+			holdout.Candidates = append(holdout.Candidates, HoldoutResult{Config: s.Config, DevScore: s.Score, DevRuns: s.Runs})
+		}
+	}
+	runHoldouts(flags, opts, split, []Holdout{holdout})
 }
 
 // ExportResults saves test results to a JSON file
-func ExportResults(results []TestResult, baseFilename string) error {
+func ExportResults(results interface{}, baseFilename string) error {
 	timestamp := time.Now().Format("2006-01-02_150405")
 	filename := fmt.Sprintf("%s_%s.json", baseFilename, timestamp)
 
@@ -217,12 +980,129 @@ func printResponse(result TestResult) {
 	fmt.Printf(">> Test Configuration:\n")
 	fmt.Printf("> Config: %s\n", result.Config)
 	fmt.Printf("> Prompt: %s\n", result.Prompt)
-	fmt.Printf("> Prompt text: %s\n", TestPrompts[result.Prompt])
+	if result.Instance != nil {
+		fmt.Printf("> Instance: #%d (seed %d)\n", result.Instance.Index, result.Instance.Seed)
+		fmt.Printf("> Prompt text: %s\n", result.Instance.Text)
+		fmt.Printf("> Expected answer: %s\n", result.Instance.Answer)
+	} else if text, ok := TestPrompts[result.Prompt]; ok {
+		fmt.Printf("> Prompt text: %s\n", text)
+	}
 
 	fmt.Printf("\nMetrics:\n")
-	fmt.Printf("- Response time: %v\n", result.Metrics.ResponseTime)
-	fmt.Printf("- Character count: %d\n", result.Metrics.CharCount)
-	fmt.Printf("- Word count: %d\n", result.Metrics.WordCount)
+	m := result.Metrics
+	fmt.Printf("- Response time: %v\n", m.ResponseTime)
+	fmt.Printf("- Characters: %d (%d graphemes, %d bytes)\n", m.CharCount, m.GraphemeCount, m.ByteCount)
+	fmt.Printf("- Words: %d, sentences: %d, paragraphs: %d\n", m.WordCount, m.SentenceCount, m.ParagraphCount)
+	if m.ResponseTokens > 0 {
+		fmt.Printf("- Tokens: %d prompt, %d response (%.1f tokens/s)\n", m.PromptTokens, m.ResponseTokens, m.TokensPerSecond)
+	}
+	if r := m.Readability; r != nil {
+		fmt.Printf("- Readability: Flesch reading ease %.1f, grade level %.1f\n", r.FleschReadingEase, r.FleschKincaidGrade)
+	}
+	if result.Language != nil {
+		fmt.Printf("- Language: %s\n", result.Language)
+	}
+	if result.DoneReason != "" {
+		fmt.Printf("- Done reason: %s\n", result.DoneReason)
+	}
+	if s := result.Stop; s != nil {
+		fmt.Printf("- Stop sequences %q: ended on stop (end token or sequence) %v", s.Sequences, s.EndedOnStop)
+		if len(s.Leaked) > 0 {
+			fmt.Printf(", NOT HONORED: %q in the response", s.Leaked)
+		}
+		fmt.Println()
+	}
+	if d := result.Degeneration; d != nil {
+		fmt.Printf("- Repetition: %.0f%% repeated 4-grams, longest repeat %d characters, compression %.1fx\n",
+			100*d.RepeatedNgramRatio, d.LongestRepeat, d.CompressionRatio)
+		if d.Degenerate {
+			fmt.Printf("- DEGENERATE: %s\n", d.Reason)
+		}
+	}
+
+	if s := result.Structured; s != nil {
+		fmt.Printf("\nStructured output:\n")
+		fmt.Printf("- Parsed: %v\n", s.ParseOK)
+		if s.ParseError != "" {
+			fmt.Printf("- Parse error: %s\n", s.ParseError)
+		}
+		fmt.Printf("- Schema valid: %v\n", s.SchemaValid)
+		for _, v := range s.Violations {
+			fmt.Printf("  - %s: %s\n", v.Pointer, v.Message)
+		}
+		if s.FieldsTotal > 0 {
+			fmt.Printf("- Field accuracy: %d/%d (%.0f%%)\n", s.FieldsMatched, s.FieldsTotal, 100*s.FieldAccuracy)
+		}
+	}
+
+	if t := result.Tools; t != nil {
+		fmt.Printf("\nTool calls (%d turns):\n", t.Turns)
+		for _, call := range t.Calls {
+			args, _ := json.Marshal(call.Arguments)
+			if call.Error != "" {
+				fmt.Printf("- %s(%s) -> error: %s\n", call.Name, args, call.Error)
+			} else {
+				fmt.Printf("- %s(%s) -> %v\n", call.Name, args, call.Result)
+			}
+		}
+		fmt.Printf("- Sequence match: %v\n", t.SequenceMatch)
+		fmt.Printf("- Argument accuracy: %.0f%%\n", 100*t.ArgumentAccuracy)
+		fmt.Printf("- Final answer correct: %v\n", t.AnswerCorrect)
+	}
+
+	if g := result.Grade; g != nil {
+		fmt.Printf("\nGrade (%s):\n", g.Grader)
+		fmt.Printf("- Verdict: %s\n", g.Verdict)
+		fmt.Printf("- Score: %.2f\n", g.Score)
+		if g.Details != "" {
+			fmt.Printf("- Details: %s\n", g.Details)
+		}
+		for _, e := range g.Errors {
+			fmt.Printf("  - %s\n", e)
+		}
+	}
+
+	if len(result.Constraints) > 0 {
+		fmt.Printf("\nConstraints:\n")
+		for _, c := range result.Constraints {
+			status := "✓"
+			if !c.Passed {
+				status = "✗"
+			}
+			if c.Details != "" {
+				fmt.Printf("- %s %s: %s\n", status, c.Constraint, c.Details)
+			} else {
+				fmt.Printf("- %s %s\n", status, c.Constraint)
+			}
+		}
+	}
+
+	if r := result.RAG; r != nil {
+		fmt.Printf("\nRetrieval (chunk=%d, k=%d, %s):\n", r.ChunkSize, r.K, r.EmbedModel)
+		fmt.Printf("- Retrieved: %s\n", strings.Join(r.Retrieved, ", "))
+		fmt.Printf("- Grounding: %d/%d sentences supported\n", r.Supported, r.Sentences)
+		for _, sentence := range r.Unsupported {
+			fmt.Printf("  - unsupported: %s\n", sentence)
+		}
+		if len(r.Citations) > 0 {
+			fmt.Printf("- Citations: %d/%d valid\n", r.ValidCitations, len(r.Citations))
+		} else {
+			fmt.Printf("- Citations: none\n")
+		}
+	}
+
+	if f := result.FIM; f != nil {
+		fmt.Printf("\nFill-in-the-middle (%s at %s:%d):\n", f.Kind, f.File, f.Line)
+		fmt.Printf("- Exact match: %v\n", f.ExactMatch)
+		fmt.Printf("- Edit similarity: %.2f\n", f.EditSimilarity)
+		if f.Compiles != nil {
+			fmt.Printf("- Compiles (%s): %v\n", f.CompileCheck, *f.Compiles)
+		}
+		if f.VetPasses != nil {
+			fmt.Printf("- Vet passes: %v\n", *f.VetPasses)
+		}
+		fmt.Printf("\nExpected:\n%s\n", f.Expected)
+	}
 
 	fmt.Printf("\nResponse:\n%s\n", result.Response)
 	fmt.Printf("\n%s\n", strings.Repeat("-", 40))
@@ -231,6 +1111,71 @@ func printResponse(result TestResult) {
 func main() {
 	flags := parseFlags()
 
+	var split *Split
+	if flags.Suite != "" {
+		suite, err := LoadSuite(flags.Suite)
+		if err != nil {
+			fmt.Printf("Error loading suite: %v\n", err)
+			return
+		}
+		split = suite.Split
+	}
+	if flags.Fold > 0 {
+		if split == nil || split.Folds == 0 {
+			fmt.Println("Error: -fold needs a suite with a k-fold split")
+			return
+		}
+		split.Fold = flags.Fold
+		if err := split.Validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+	}
+	if err := ApplyOverrides(flags.Set); err != nil {
+		fmt.Printf("Error parsing -set: %v\n", err)
+		return
+	}
+
+	if flags.Command == CommandConfigs {
+		if err := RunConfigsCommand(flags.Args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	if len(flags.Args) > 0 {
+		fmt.Printf("Unexpected argument: %s\n", flags.Args[0])
+		fmt.Println("Available commands: run, embed, needle, determinism, configs, ablate, optimize, race")
+		return
+	}
+
+	// Presets are validated before anything reaches the server
+	if errs := ValidateConfigs(); len(errs) > 0 {
+		fmt.Println("Invalid configurations:")
+		for _, err := range errs {
+			fmt.Printf("- %v\n", err)
+		}
+		return
+	}
+
+	if flags.Command == CommandEmbed {
+		models := flags.EmbedModels
+		if models == "" {
+			models = flags.Model
+		}
+		results, err := RunEmbedCommand(flags.URL, models, flags.Corpus, flags.K)
+		if err != nil {
+			fmt.Printf("Error running embeddings: %v\n", err)
+			return
+		}
+		if flags.ExportJSON {
+			if err := ExportResults(results, "embed_results"); err != nil {
+				fmt.Printf("Error exporting results: %v\n", err)
+			}
+		}
+		return
+	}
+
 	// Parse and validate configurations
 	selectedConfigs, err := ParseConfigs(flags.Configs)
 	if err != nil {
@@ -239,6 +1184,11 @@ func main() {
 		return
 	}
 
+	if flags.Command == CommandNeedle {
+		runNeedle(flags, selectedConfigs)
+		return
+	}
+
 	// Parse and validate specific prompts if provided
 	selectedPrompts, err := ParsePrompts(flags.Prompts)
 	if err != nil {
@@ -255,6 +1205,37 @@ func main() {
 		return
 	}
 
+	schemaMode, err := ParseSchemaMode(flags.SchemaMode)
+	if err != nil {
+		fmt.Printf("Error parsing schema mode: %v\n", err)
+		return
+	}
+
+	voteMethod, err := ParseVoteMethod(flags.Vote)
+	if err != nil {
+		fmt.Printf("Error parsing vote method: %v\n", err)
+		return
+	}
+	if voteMethod != "" && flags.Trials < 2 {
+		fmt.Printf("Error: -vote needs -trials of at least 2\n")
+		return
+	}
+	judgeModel := flags.JudgeModel
+	if judgeModel == "" {
+		judgeModel = flags.Model
+	}
+
+	chunkSizes, err := ParseIntList(flags.RAGChunks)
+	if err != nil {
+		fmt.Printf("Error parsing RAG chunk sizes: %v\n", err)
+		return
+	}
+	ks, err := ParseIntList(flags.RAGK)
+	if err != nil {
+		fmt.Printf("Error parsing RAG k: %v\n", err)
+		return
+	}
+
 	// Determine which test pattern to use
 	var pattern TestPattern
 
@@ -275,22 +1256,144 @@ func main() {
 		pattern = RandomTest(5, 5)
 	}
 
+	// Tuning commands split the prompts themselves and always tune on dev
+	if flags.Split != "" {
+		if split == nil {
+			fmt.Println("Error: -split needs a suite with a split")
+			return
+		}
+		if flags.Command == CommandAblate || flags.Command == CommandOptimize || flags.Command == CommandRace {
+			fmt.Printf("Error: -split does not apply to %s, which tunes on dev and reports on test\n", flags.Command)
+			return
+		}
+		dev, test := split.Partition(pattern.prompts)
+		switch flags.Split {
+		case SplitDev:
+			pattern.prompts = dev
+		case SplitTest:
+			pattern.prompts = test
+		default:
+			fmt.Printf("Error: invalid split %q: expected %s or %s\n", flags.Split, SplitDev, SplitTest)
+			return
+		}
+		if len(pattern.prompts) == 0 {
+			fmt.Printf("Error: no selected prompts in the %s split\n", flags.Split)
+			return
+		}
+	}
+
 	// Run tests
 	startTime := time.Now()
-	results, err := RunTestPattern(flags.URL, flags.Model, pattern, flags.PrintResults)
-	if err != nil {
-		fmt.Printf("Error running tests: %v\n", err)
+	opts := RunOptions{
+		URL:          flags.URL,
+		Model:        flags.Model,
+		SchemaMode:   schemaMode,
+		RAG:          RAGOptions{EmbedModel: flags.RAGEmbed, ChunkSizes: chunkSizes, Ks: ks},
+		Seed:         flags.Seed,
+		Instances:    flags.Instances,
+		Trials:       flags.Trials,
+		SampleSeed:   flags.SampleSeed,
+		SeedSampling: flags.SampleSeedSet,
+		Print:        flags.PrintResults,
+		Stream:       flags.Stream,
+		Watchdog:     flags.Watchdog,
+	}
+
+	if flags.Command == CommandDeterminism {
+		checks := RunDeterminism(opts, pattern)
+		if flags.ExportJSON {
+			if err := ExportResults(checks, "determinism_results"); err != nil {
+				fmt.Printf("Error exporting results: %v\n", err)
+			}
+		}
+		printDeterminismSummary(checks)
+		fmt.Printf("\nCompleted %d determinism checks in %v\n", len(checks), time.Since(startTime))
+		return
+	}
+
+	if flags.Command == CommandAblate {
+		runAblate(flags, opts, split, selectedPrompts, selectedPatterns)
+		fmt.Printf("\nCompleted ablation in %v\n", time.Since(startTime))
+		return
+	}
+
+	if flags.Command == CommandOptimize {
+		runOptimize(flags, opts, split, pattern.prompts, len(selectedPrompts)+len(selectedPatterns) > 0)
+		fmt.Printf("\nCompleted optimization in %v\n", time.Since(startTime))
 		return
 	}
 
+	if flags.Command == CommandRace {
+		runRace(flags, opts, split, pattern, len(selectedPrompts)+len(selectedPatterns) > 0)
+		fmt.Printf("\nCompleted race in %v\n", time.Since(startTime))
+		return
+	}
+
+	var results []TestResult
+	if flags.FIM != "" {
+		spans, err := ParseFIMSpans(flags.FIMSpans)
+		if err != nil {
+			fmt.Printf("Error parsing FIM spans: %v\n", err)
+			return
+		}
+		cases, err := LoadFIMCases(strings.Split(flags.FIM, ","), spans, flags.FIMSamples)
+		if err != nil {
+			fmt.Printf("Error loading FIM cases: %v\n", err)
+			return
+		}
+		configs := selectedConfigs
+		if len(configs) == 0 {
+			configs = AllConfigs()
+		}
+		results = RunFIM(opts, cases, configs)
+	} else {
+		results, err = RunTestPattern(opts, pattern)
+		if err != nil {
+			fmt.Printf("Error running tests: %v\n", err)
+			return
+		}
+	}
+
+	var diversity []DiversityResult
+	if flags.Trials > 1 {
+		diversity = AnalyzeDiversity(flags.URL, flags.DivEmbed, results)
+	}
+	var votes []VoteResult
+	if voteMethod != "" {
+		votes = Vote(opts, voteMethod, judgeModel, results)
+	}
+
 	// Export results if flag is set
 	if flags.ExportJSON {
 		if err := ExportResults(results, "test_results"); err != nil {
 			fmt.Printf("Error exporting results: %v\n", err)
 			return
 		}
+		if len(diversity) > 0 {
+			if err := ExportResults(diversity, "diversity_results"); err != nil {
+				fmt.Printf("Error exporting diversity: %v\n", err)
+				return
+			}
+		}
+		if len(votes) > 0 {
+			if err := ExportResults(votes, "vote_results"); err != nil {
+				fmt.Printf("Error exporting votes: %v\n", err)
+				return
+			}
+		}
 	}
 
 	// Print summary
+	printStructuredSummary(results)
+	printToolSummary(results)
+	printGradeSummary(results)
+	printFIMSummary(results)
+	printRAGSummary(results)
+	printGeneratedSummary(results)
+	printConstraintSummary(results)
+	printDegenerationSummary(results)
+	printStopSummary(results)
+	printDiversitySummary(diversity)
+	printVoteSummary(votes)
 	fmt.Printf("\nCompleted %d tests in %v\n", len(results), time.Since(startTime))
 }
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Exact-math grader verdicts
+const (
+	VerdictNoNumber   = "no_number"
+	VerdictWrongValue = "wrong_value"
+)
+
+// Quantity is a number found in free text, normalized to a rational.
+// Decimals is the number of decimal places written, on the scale the
+// number was written in (percent or plain), or -1 for fractions, and
+// Digits the number of significant digits written. Offset is where the
+// number starts in the text.
+type Quantity struct {
+	Text     string
+	Offset   int
+	Value    *big.Rat
+	Decimals int
+	Digits   int
+	Percent  bool
+}
+
+// minRoundedDigits is the precision a rounded answer needs to count, so
+// "0.03" does not pass for 1/36 while "0.028" and "2.78%" do.
+const minRoundedDigits = 2
+
+// quantityPattern matches "1/36", "1 in 36", "1 out of 36", odds such as
+// "1 to 35", "2.78%", "12.5 percent", "$1,200.50" and plain numbers. Commas
+// are only taken as thousands separators.
+var quantityPattern = regexp.MustCompile(`(?i)(-?\$?(?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?|-?\.\d+)(?:\s*(/|\bin\b|\bout of\b|\bto\b)\s*((?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?)|\s*(%|\bpercent\b))?`)
+
+// ParseQuantities returns the numbers of text in order of appearance
+func ParseQuantities(text string) []Quantity {
+	var quantities []Quantity
+	offsets := quantityPattern.FindAllStringIndex(text, -1)
+	for k, match := range quantityPattern.FindAllStringSubmatch(text, -1) {
+		value, decimals, ok := parseDecimal(match[1])
+		if !ok {
+			continue
+		}
+		q := Quantity{
+			Text:     strings.TrimSpace(match[0]),
+			Offset:   offsets[k][0],
+			Value:    value,
+			Decimals: decimals,
+			Digits:   len(strings.TrimLeft(strings.Map(keepDigits, match[1]), "0")),
+		}
+
+		switch {
+		case match[2] != "":
+			denominator, _, ok := parseDecimal(match[3])
+			if !ok {
+				continue
+			}
+			// Odds of a to b are a chance of a in a+b
+			if strings.EqualFold(match[2], "to") {
+				denominator.Add(denominator, value)
+			}
+			if denominator.Sign() == 0 {
+				continue
+			}
+			q.Value = new(big.Rat).Quo(value, denominator)
+			q.Decimals = -1
+		case match[4] != "":
+			q.Value = new(big.Rat).Quo(value, big.NewRat(100, 1))
+			q.Percent = true
+		}
+
+		quantities = append(quantities, q)
+	}
+	return quantities
+}
+
+// parseDecimal parses a number literal, ignoring currency signs and
+// thousands separators, and counts its decimal places.
+func parseDecimal(literal string) (*big.Rat, int, bool) {
+	literal = strings.NewReplacer("$", "", ",", "").Replace(literal)
+	value, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		return nil, 0, false
+	}
+	decimals := 0
+	if dot := strings.IndexByte(literal, '.'); dot >= 0 {
+		decimals = len(literal) - dot - 1
+	}
+	return value, decimals, true
+}
+
+func keepDigits(r rune) rune {
+	if r >= '0' && r <= '9' {
+		return r
+	}
+	return -1
+}
+
+// Matches reports whether q denotes want: exactly, or as want rounded to
+// the decimal places q was written with, so "2.78%" matches 1/36.
+func (q Quantity) Matches(want *big.Rat) (exact, rounded bool) {
+	if q.Value.Cmp(want) == 0 {
+		return true, false
+	}
+	if q.Decimals <= 0 || q.Digits < minRoundedDigits {
+		return false, false
+	}
+
+	scale := big.NewRat(1, 1)
+	if q.Percent {
+		scale = big.NewRat(100, 1)
+	}
+	written := new(big.Rat).Mul(q.Value, scale)
+	expected := roundRat(new(big.Rat).Mul(want, scale), q.Decimals)
+	return false, written.Cmp(expected) == 0
+}
+
+// roundRat rounds x to the given number of decimal places, halves away
+// from zero.
+func roundRat(x *big.Rat, decimals int) *big.Rat {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	scaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(pow))
+
+	// Add one half toward the sign, then truncate
+	half := big.NewRat(1, 2)
+	if scaled.Sign() < 0 {
+		half.Neg(half)
+	}
+	scaled.Add(scaled, half)
+	truncated := new(big.Int).Quo(scaled.Num(), scaled.Denom())
+
+	return new(big.Rat).SetFrac(truncated, pow)
+}
+
+// answerMarker introduces the final answer of a response, as in
+// "Answer: 7.5" or "the final answer is 7.5"
+var answerMarker = regexp.MustCompile(`(?i)\banswer\b`)
+
+// finalQuantity returns the index in quantities of a response's final
+// answer: the first number after the last "answer" followed by one, or else
+// the last number.
+func finalQuantity(response string, quantities []Quantity) int {
+	markers := answerMarker.FindAllStringIndex(response, -1)
+	for m := len(markers) - 1; m >= 0; m-- {
+		for i, q := range quantities {
+			if q.Offset >= markers[m][1] {
+				return i
+			}
+		}
+	}
+	return len(quantities) - 1
+}
+
+// ExactGrader checks the final answer of a response, compared as an exact
+// rational with the last expected value. A number written with fewer
+// decimals counts when it is the expected value correctly rounded. Earlier
+// expected values, such as the variables of an LP solution, may appear
+// anywhere in the response.
+type ExactGrader struct {
+	Answers []*big.Rat
+	// Labels optionally name the answers in details
+	Labels []string
+	// Percent marks answers that are percentages, so "37.5" and "37.5%"
+	// both match 37.5
+	Percent bool
+	// Words also reads small counts written as words, such as "three" or
+	// "twice"
+	Words bool
+}
+
+// countWordPattern matches the counts read by an ExactGrader with Words
+var countWordPattern = regexp.MustCompile(`(?i)\b(?:` + strings.Join(numberWords, "|") + `|once|twice)\b`)
+
+// quantities returns the numbers of a response, with counts written as
+// words when the grader reads them
+func (g ExactGrader) quantities(response string) []Quantity {
+	quantities := ParseQuantities(response)
+	if !g.Words {
+		return quantities
+	}
+	for _, loc := range countWordPattern.FindAllStringIndex(response, -1) {
+		word := response[loc[0]:loc[1]]
+		var n int
+		switch strings.ToLower(word) {
+		case "once":
+			n = 1
+		case "twice":
+			n = 2
+		default:
+			n = slices.Index(numberWords, strings.ToLower(word))
+		}
+		quantities = append(quantities, Quantity{Text: word, Offset: loc[0], Value: big.NewRat(int64(n), 1), Digits: 1})
+	}
+	sort.SliceStable(quantities, func(i, j int) bool { return quantities[i].Offset < quantities[j].Offset })
+	return quantities
+}
+
+func (g ExactGrader) Name() string { return "exact-math" }
+
+func (g ExactGrader) Grade(response string) *Grade {
+	grade := &Grade{Grader: g.Name(), Total: len(g.Answers)}
+
+	quantities := g.quantities(response)
+	if len(quantities) == 0 {
+		grade.Verdict = VerdictNoNumber
+		grade.Details = "no number found in the response"
+		return grade
+	}
+
+	final := finalQuantity(response, quantities)
+
+	var found, missing []string
+	for i, want := range g.Answers {
+		label := want.RatString()
+		if i < len(g.Labels) {
+			label = g.Labels[i] + "=" + label
+		}
+
+		candidates := quantities
+		if i == len(g.Answers)-1 {
+			candidates = quantities[final : final+1]
+		}
+		match := ""
+		for _, q := range candidates {
+			target := want
+			if g.Percent && q.Percent {
+				target = new(big.Rat).Quo(want, big.NewRat(100, 1))
+			}
+			if exact, rounded := q.Matches(target); exact {
+				match = q.Text
+				break
+			} else if rounded && match == "" {
+				match = q.Text + " (rounded)"
+			}
+		}
+
+		if match != "" {
+			grade.Passes++
+			found = append(found, fmt.Sprintf("%s as %s", label, match))
+		} else if i == len(g.Answers)-1 {
+			missing = append(missing, fmt.Sprintf("%s as the final answer (got %s)", label, quantities[final].Text))
+		} else {
+			missing = append(missing, label)
+		}
+	}
+
+	if grade.Total > 0 {
+		grade.Score = float64(grade.Passes) / float64(grade.Total)
+	}
+	grade.Passed = len(missing) == 0
+	if grade.Passed {
+		grade.Verdict = VerdictCorrect
+		grade.Details = "found " + strings.Join(found, ", ")
+	} else {
+		grade.Verdict = VerdictWrongValue
+		grade.Details = "missing " + strings.Join(missing, ", ")
+	}
+
+	return grade
+}
+
+// Extract returns the final answer of the response, normalized to the
+// matching expected value when it is one, so "2.78%" and "1/36" count as
+// the same answer.
+func (g ExactGrader) Extract(response string) string {
+	quantities := g.quantities(response)
+	if len(quantities) == 0 {
+		return ""
+	}
+	q := quantities[finalQuantity(response, quantities)]
+	for _, want := range g.Answers {
+		target := want
+		if g.Percent && q.Percent {
+			target = new(big.Rat).Quo(want, big.NewRat(100, 1))
+		}
+		if exact, rounded := q.Matches(target); exact || rounded {
+			return want.RatString()
+		}
+	}
+	if g.Percent && q.Percent {
+		return new(big.Rat).Mul(q.Value, big.NewRat(100, 1)).RatString()
+	}
+	return q.Value.RatString()
+}
+
+// Correct reports whether an extracted answer is the last expected value,
+// the one a response states last
+func (g ExactGrader) Correct(answer string) bool {
+	return len(g.Answers) > 0 && answer == g.Answers[len(g.Answers)-1].RatString()
+}
+
+// mustRat parses a rational literal such as "40", "2.5" or "1/36"
+func mustRat(literal string) *big.Rat {
+	value, ok := new(big.Rat).SetString(literal)
+	if !ok {
+		panic("invalid rational: " + literal)
+	}
+	return value
+}
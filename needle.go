@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+)
+
+// charsPerToken approximates token counts of English filler text
+const charsPerToken = 4
+
+// needleQuestion is appended after the haystack
+const needleQuestion = "What is the secret passphrase mentioned in the text above? Answer with the passphrase only."
+
+// haystackSentences is the filler the needle is hidden in: bland, self-
+// contained sentences that never mention a passphrase.
+var haystackSentences = []string{
+	"The village of Marlow sits on the eastern bank of a slow, wide river.",
+	"Its market opens every Saturday morning and closes shortly after noon.",
+	"Most houses in the old town were built from grey limestone quarried nearby.",
+	"A stone bridge with five arches connects the village to the farmland across the water.",
+	"In spring, the orchards along the valley road bloom within the same two weeks.",
+	"The local school was extended twice during the last century to make room for more pupils.",
+	"Fishermen still use flat-bottomed boats that were designed for the shallow river bends.",
+	"The church clock is wound by hand every Sunday after the evening service.",
+	"A narrow railway line once carried timber from the northern forest to the coast.",
+	"The library keeps records of every flood the village has seen since the sixteenth century.",
+	"Summer evenings are often spent on the green, where a brass band plays on public holidays.",
+	"Farmers in the area grow barley, potatoes and a small amount of flax.",
+	"The old mill was converted into a museum about traditional weaving.",
+	"Visitors usually arrive by the regional bus, which stops at the post office every hour.",
+	"Winters are mild, although the river mist can linger until midday.",
+	"The bakery on the main street has been run by the same family for four generations.",
+	"A footpath follows the river south to the ruins of a medieval priory.",
+	"Every autumn, the harvest festival fills the square with stalls and music.",
+	"The council meets on the first Tuesday of each month in the town hall.",
+	"Swallows nest under the eaves of the barns from May until September.",
+	"The blacksmith's forge now serves as a workshop for repairing bicycles.",
+	"Children learn to swim in a sheltered pool formed by an old weir.",
+	"The hills to the west are covered with heather and crossed by dry stone walls.",
+	"A weekly newspaper reports on weddings, football results and planning decisions.",
+}
+
+var (
+	needleColors  = []string{"amber", "cobalt", "crimson", "jade", "ivory", "onyx", "saffron", "teal"}
+	needleAnimals = []string{"falcon", "otter", "lynx", "heron", "badger", "marten", "ibis", "viper"}
+)
+
+// NeedleOptions selects the grid of a needle-in-a-haystack run
+type NeedleOptions struct {
+	URL     string
+	Model   string
+	Configs []ConfigKey
+	// Lengths are haystack sizes in approximate tokens
+	Lengths []int
+	// Depths are needle positions in percent of the haystack
+	Depths  []int
+	NumCtxs []int
+	Print   bool
+	// SampleSeed is sent as the sampling seed of every request when
+	// SeedSampling is set
+	SampleSeed   int64
+	SeedSampling bool
+}
+
+// NeedleResult is one cell of the depth×length grid for a config and num_ctx
+type NeedleResult struct {
+	Config       ConfigKey     `json:"config"`
+	NumCtx       int           `json:"numCtx"`
+	Length       int           `json:"length"`
+	Depth        int           `json:"depth"`
+	Passphrase   string        `json:"passphrase"`
+	Found        bool          `json:"found"`
+	Response     string        `json:"response"`
+	PromptTokens int           `json:"promptTokens"`
+	ResponseTime time.Duration `json:"responseTime"`
+	MemoryBytes  int64         `json:"memoryBytes"`
+	VRAMBytes    int64         `json:"vramBytes"`
+	Timestamp    time.Time     `json:"timestamp"`
+}
+
+// needlePassphrase derives a passphrase from the cell, so every cell looks
+// for a different needle and cached answers cannot leak between cells.
+func needlePassphrase(length, depth, numCtx int) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d/%d/%d", length, depth, numCtx)
+	sum := h.Sum32()
+	return fmt.Sprintf("%s-%s-%d",
+		needleColors[sum%uint32(len(needleColors))],
+		needleAnimals[(sum/8)%uint32(len(needleAnimals))],
+		10+(sum/64)%90)
+}
+
+// BuildHaystack returns filler text of about length tokens with a sentence
+// holding the passphrase inserted at depth percent.
+func BuildHaystack(length, depth int, passphrase string) string {
+	var sentences []string
+	chars := 0
+	for i := 0; chars < length*charsPerToken; i++ {
+		sentence := haystackSentences[i%len(haystackSentences)]
+		sentences = append(sentences, sentence)
+		chars += len(sentence) + 1
+	}
+
+	needle := fmt.Sprintf("The secret passphrase for the archive room is %s.", passphrase)
+	at := len(sentences) * depth / 100
+	sentences = append(sentences[:at], append([]string{needle}, sentences[at:]...)...)
+
+	return strings.Join(sentences, " ")
+}
+
+// RunNeedle runs every config over the num_ctx × length × depth grid
+func RunNeedle(opts NeedleOptions) []NeedleResult {
+	var results []NeedleResult
+
+	for _, config := range opts.Configs {
+		for _, numCtx := range opts.NumCtxs {
+			options := OllamaOptions(Configs[config])
+			options["num_ctx"] = numCtx
+			if opts.SeedSampling {
+				options["seed"] = opts.SampleSeed
+			}
+
+			for _, length := range opts.Lengths {
+				for _, depth := range opts.Depths {
+					fmt.Printf("🪡 Running %s with num_ctx=%d, length=%d, depth=%d%%\n", config, numCtx, length, depth)
+
+					passphrase := needlePassphrase(length, depth, numCtx)
+					request := GenerateRequest{
+						Model:   opts.Model,
+						Prompt:  BuildHaystack(length, depth, passphrase) + "\n\n" + needleQuestion,
+						Options: options,
+					}
+
+					start := time.Now()
+					answer, err := Generate(opts.URL, request)
+					if err != nil {
+						fmt.Printf("Error running cell: %v\n", err)
+						continue
+					}
+
+					result := NeedleResult{
+						Config:       config,
+						NumCtx:       numCtx,
+						Length:       length,
+						Depth:        depth,
+						Passphrase:   passphrase,
+						Found:        containsWord(answer.Response, passphrase),
+						Response:     answer.Response,
+						PromptTokens: answer.PromptEvalCount,
+						ResponseTime: time.Since(start),
+						Timestamp:    time.Now(),
+					}
+
+					// Memory is read while the model is still loaded with this num_ctx
+					if models, err := RunningModels(opts.URL); err == nil {
+						for _, m := range models {
+							if m.Name == opts.Model || m.Name == opts.Model+":latest" || m.Model == opts.Model {
+								result.MemoryBytes, result.VRAMBytes = m.Size, m.SizeVRAM
+							}
+						}
+					}
+
+					if opts.Print {
+						fmt.Printf("- found=%v prompt_tokens=%d time=%v\n", result.Found, result.PromptTokens, result.ResponseTime.Round(time.Millisecond))
+					}
+
+					results = append(results, result)
+				}
+			}
+		}
+	}
+
+	printNeedleSummary(results)
+	return results
+}
+
+// printNeedleSummary prints a depth×length recall heatmap per config and
+// num_ctx, followed by latency and memory per length.
+func printNeedleSummary(results []NeedleResult) {
+	type grid struct {
+		lengths, depths map[int]bool
+		cells           map[[2]int]NeedleResult
+	}
+	type gridKey struct {
+		config ConfigKey
+		numCtx int
+	}
+	grids := make(map[gridKey]*grid)
+	var keys []gridKey
+
+	for _, r := range results {
+		key := gridKey{r.Config, r.NumCtx}
+		g, ok := grids[key]
+		if !ok {
+			g = &grid{lengths: map[int]bool{}, depths: map[int]bool{}, cells: map[[2]int]NeedleResult{}}
+			grids[key] = g
+			keys = append(keys, key)
+		}
+		g.lengths[r.Length] = true
+		g.depths[r.Depth] = true
+		g.cells[[2]int{r.Depth, r.Length}] = r
+	}
+
+	// Grids are grouped by config, with num_ctx in numeric order
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].config != keys[j].config {
+			return keys[i].config < keys[j].config
+		}
+		return keys[i].numCtx < keys[j].numCtx
+	})
+
+	for _, key := range keys {
+		g := grids[key]
+		lengths, depths := sortedInts(g.lengths), sortedInts(g.depths)
+
+		fmt.Printf("\nNeedle recall (%s num_ctx=%d), depth × length in tokens:\n", key.config, key.numCtx)
+		fmt.Printf("%6s", "")
+		for _, length := range lengths {
+			fmt.Printf(" %7d", length)
+		}
+		fmt.Println()
+		for _, depth := range depths {
+			fmt.Printf("%5d%%", depth)
+			for _, length := range lengths {
+				cell, ok := g.cells[[2]int{depth, length}]
+				switch {
+				case !ok:
+					fmt.Printf(" %7s", "-")
+				case cell.Found:
+					fmt.Printf(" %7s", "✓")
+				default:
+					fmt.Printf(" %7s", "✗")
+				}
+			}
+			fmt.Println()
+		}
+
+		fmt.Printf("%-8s %8s %13s %10s %10s %10s\n", "Length", "Recall", "Prompt toks", "Latency", "Memory", "VRAM")
+		for _, length := range lengths {
+			var found, runs, tokens int
+			var latency time.Duration
+			var memory, vram int64
+			for _, depth := range depths {
+				cell, ok := g.cells[[2]int{depth, length}]
+				if !ok {
+					continue
+				}
+				runs++
+				if cell.Found {
+					found++
+				}
+				tokens += cell.PromptTokens
+				latency += cell.ResponseTime
+				memory, vram = max(memory, cell.MemoryBytes), max(vram, cell.VRAMBytes)
+			}
+			if runs == 0 {
+				continue
+			}
+			fmt.Printf("%-8d %7.0f%% %13d %10s %10s %10s\n", length, 100*float64(found)/float64(runs),
+				tokens/runs, (latency / time.Duration(runs)).Round(time.Millisecond), formatBytes(memory), formatBytes(vram))
+		}
+	}
+}
+
+func sortedInts(set map[int]bool) []int {
+	values := make([]int, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Ints(values)
+	return values
+}
+
+func formatBytes(n int64) string {
+	if n <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// GenerateRequest is the body of an Ollama /api/generate call. It mirrors
+// llm.GenQuery but also carries the fields parakeet does not model, such as a
+// JSON Schema passed through `format` or base64 images.
+type GenerateRequest struct {
+	Model   string                 `json:"model"`
+	Prompt  string                 `json:"prompt"`
+	Suffix  string                 `json:"suffix,omitempty"`
+	System  string                 `json:"system,omitempty"`
+	Format  json.RawMessage        `json:"format,omitempty"`
+	Images  []string               `json:"images,omitempty"`
+	Options map[string]interface{} `json:"options,omitempty"`
+	Stream  bool                   `json:"stream"`
+}
+
+// GenerateResponse is the final (non-streamed) answer of /api/generate
+type GenerateResponse struct {
+	Model           string `json:"model"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	TotalDuration   int64  `json:"total_duration"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	EvalDuration    int64  `json:"eval_duration"`
+}
+
+// OllamaOptions converts a preset into the options object sent to Ollama,
+// using the catalog defaults for every key the preset leaves unset.
+func OllamaOptions(config map[string]interface{}) map[string]interface{} {
+	return ResolveOptions(config)
+}
+
+// postJSON sends body to an Ollama endpoint and decodes the JSON answer into out
+func postJSON(url, endpoint string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	resp, err := http.Post(url+endpoint, "application/json; charset=utf-8", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code: %s\n%s", resp.Status, string(data))
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return nil
+}
+
+// Generate sends a non-streaming completion request to Ollama
+func Generate(url string, req GenerateRequest) (GenerateResponse, error) {
+	req.Stream = false
+
+	var answer GenerateResponse
+	if err := postJSON(url, "/api/generate", req, &answer); err != nil {
+		return GenerateResponse{}, err
+	}
+
+	return answer, nil
+}
+
+// GenerateStream sends a streaming completion request to Ollama and passes
+// each chunk of text to onChunk. When onChunk returns false the connection
+// is closed, which cancels the generation, and the partial answer is
+// returned with Done unset and the "cancelled" done reason. Ollama only
+// reports token counts in the final chunk, so a cancelled answer counts
+// each chunk received as a token, at the rate they arrived at.
+// A stream ending before the final chunk is an error.
+func GenerateStream(url string, req GenerateRequest, onChunk func(string) bool) (GenerateResponse, error) {
+	req.Stream = true
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return GenerateResponse{}, fmt.Errorf("failed to encode request: %v", err)
+	}
+
+	resp, err := http.Post(url+"/api/generate", "application/json; charset=utf-8", bytes.NewReader(payload))
+	if err != nil {
+		return GenerateResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return GenerateResponse{}, fmt.Errorf("status code: %s\n%s", resp.Status, string(data))
+	}
+
+	var answer GenerateResponse
+	var text strings.Builder
+	var first time.Time
+	decoder := json.NewDecoder(resp.Body)
+	for chunks := 1; ; chunks++ {
+		var chunk GenerateResponse
+		if err := decoder.Decode(&chunk); err == io.EOF {
+			return GenerateResponse{}, fmt.Errorf("stream ended before the final chunk")
+		} else if err != nil {
+			return GenerateResponse{}, fmt.Errorf("failed to decode response: %v", err)
+		}
+
+		text.WriteString(chunk.Response)
+		if chunk.Done {
+			answer = chunk
+			break
+		}
+		if chunks == 1 {
+			first = time.Now()
+		}
+		if !onChunk(chunk.Response) {
+			answer.DoneReason = DoneReasonCancelled
+			// The chunks after the first one took the time since it
+			answer.EvalCount = chunks
+			if chunks > 1 {
+				answer.EvalDuration = int64(time.Since(first)) * int64(chunks) / int64(chunks-1)
+			}
+			break
+		}
+	}
+	answer.Response = text.String()
+
+	return answer, nil
+}
+
+// ChatMessage is a single message of an Ollama /api/chat conversation
+type ChatMessage struct {
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+// ToolCall is a function call requested by the model
+type ToolCall struct {
+	Function struct {
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments"`
+	} `json:"function"`
+}
+
+// ChatRequest is the body of an Ollama /api/chat call
+type ChatRequest struct {
+	Model    string                 `json:"model"`
+	Messages []ChatMessage          `json:"messages"`
+	Tools    []llm.Tool             `json:"tools,omitempty"`
+	Format   json.RawMessage        `json:"format,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+	Stream   bool                   `json:"stream"`
+}
+
+// ChatResponse is the final (non-streamed) answer of /api/chat
+type ChatResponse struct {
+	Model           string      `json:"model"`
+	Message         ChatMessage `json:"message"`
+	Done            bool        `json:"done"`
+	DoneReason      string      `json:"done_reason"`
+	TotalDuration   int64       `json:"total_duration"`
+	PromptEvalCount int         `json:"prompt_eval_count"`
+	EvalCount       int         `json:"eval_count"`
+	EvalDuration    int64       `json:"eval_duration"`
+}
+
+// Chat sends a non-streaming chat request to Ollama
+func Chat(url string, req ChatRequest) (ChatResponse, error) {
+	req.Stream = false
+
+	var answer ChatResponse
+	if err := postJSON(url, "/api/chat", req, &answer); err != nil {
+		return ChatResponse{}, err
+	}
+
+	return answer, nil
+}
+
+// EmbedRequest is the body of an Ollama /api/embed call
+type EmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// EmbedResponse holds one embedding per input
+type EmbedResponse struct {
+	Model      string      `json:"model"`
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+// Embed computes embeddings for a batch of inputs
+func Embed(url string, req EmbedRequest) (EmbedResponse, error) {
+	var answer EmbedResponse
+	if err := postJSON(url, "/api/embed", req, &answer); err != nil {
+		return EmbedResponse{}, err
+	}
+
+	if len(answer.Embeddings) != len(req.Input) {
+		return EmbedResponse{}, fmt.Errorf("expected %d embeddings, got %d", len(req.Input), len(answer.Embeddings))
+	}
+
+	return answer, nil
+}
+
+// RunningModel is a model loaded in memory, as listed by /api/ps
+type RunningModel struct {
+	Name     string `json:"name"`
+	Model    string `json:"model"`
+	Size     int64  `json:"size"`
+	SizeVRAM int64  `json:"size_vram"`
+}
+
+// RunningModels lists the models Ollama currently holds in memory
+func RunningModels(url string) ([]RunningModel, error) {
+	resp, err := http.Get(url + "/api/ps")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %s", resp.Status)
+	}
+
+	var answer struct {
+		Models []RunningModel `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	return answer.Models, nil
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSearchSpace is searched when -optimize-space is empty
+const DefaultSearchSpace = "temperature,top_k,top_p,min_p,repeat_penalty,presence_penalty"
+
+// Tree-structured Parzen Estimator settings: random trials before the
+// model is used, the fraction of trials counted as good, and the number of
+// candidates drawn from the good density per trial
+const (
+	tpeStartup    = 5
+	tpeGamma      = 0.25
+	tpeCandidates = 24
+)
+
+// SearchParam is an option searched over [Low, High]. Integer options are
+// rounded, and float options to three decimals.
+type SearchParam struct {
+	Name string     `json:"name"`
+	Type OptionType `json:"type"`
+	Low  float64    `json:"low"`
+	High float64    `json:"high"`
+}
+
+// ParseSearchSpace parses a comma-separated list of options, each with its
+// catalog sweep as range or an explicit one, e.g. "temperature=0:1.5,top_p".
+func ParseSearchSpace(text string) ([]SearchParam, error) {
+	var space []SearchParam
+	for _, item := range strings.Split(text, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, bounds, explicit := strings.Cut(item, "=")
+		spec, ok := LookupOption(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown option %s", name)
+		}
+		if spec.Type != OptionInt && spec.Type != OptionFloat {
+			return nil, fmt.Errorf("%s is not numeric and cannot be searched", spec.Name)
+		}
+
+		param := SearchParam{Name: spec.Name, Type: spec.Type}
+		switch {
+		case explicit:
+			low, high, ok := strings.Cut(bounds, ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid range %q for %s: expected low:high", bounds, spec.Name)
+			}
+			var err error
+			if param.Low, err = strconv.ParseFloat(strings.TrimSpace(low), 64); err != nil {
+				return nil, fmt.Errorf("invalid range %q for %s: %v", bounds, spec.Name, err)
+			}
+			if param.High, err = strconv.ParseFloat(strings.TrimSpace(high), 64); err != nil {
+				return nil, fmt.Errorf("invalid range %q for %s: %v", bounds, spec.Name, err)
+			}
+		case len(spec.Sweep) > 0:
+			param.Low, param.High = math.Inf(1), math.Inf(-1)
+			for _, value := range spec.Sweep {
+				x, _ := toFloat(value)
+				param.Low, param.High = min(param.Low, x), max(param.High, x)
+			}
+		default:
+			return nil, fmt.Errorf("%s has no default range; give it as %s=low:high", spec.Name, spec.Name)
+		}
+
+		if param.Low >= param.High {
+			return nil, fmt.Errorf("empty range [%g, %g] for %s", param.Low, param.High, spec.Name)
+		}
+		for _, x := range []float64{param.Low, param.High} {
+			if _, err := spec.Check(param.value(x)); err != nil {
+				return nil, err
+			}
+		}
+		space = append(space, param)
+	}
+	if len(space) == 0 {
+		return nil, fmt.Errorf("no options to search")
+	}
+	return space, nil
+}
+
+// value converts a point of the range to the option's type
+func (p SearchParam) value(x float64) interface{} {
+	if p.Type == OptionInt {
+		return int(math.Round(x))
+	}
+	return x
+}
+
+func (p SearchParam) normalize(x float64) float64 { return (x - p.Low) / (p.High - p.Low) }
+
+func (p SearchParam) denormalize(u float64) float64 {
+	x := p.Low + u*(p.High-p.Low)
+	if p.Type == OptionInt {
+		return math.Round(x)
+	}
+	return math.Round(x*1000) / 1000
+}
+
+// StudyTrial is one evaluated point of the search. Runs is 0 when no
+// graded response came back, and the trial is left out of the model.
+type StudyTrial struct {
+	Number    int                `json:"number"`
+	Params    map[string]float64 `json:"params"`
+	Runs      int                `json:"runs"`
+	Score     float64            `json:"score"`
+	Latency   float64            `json:"latency"`
+	Objective float64            `json:"objective"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// Study is the state of a search, saved after every trial so it can be
+// resumed. The objective is the mean grader score minus LatencyWeight
+// times the mean latency in seconds.
+type Study struct {
+	Base          ConfigKey     `json:"base"`
+	Model         string        `json:"model"`
+	Prompts       []PromptKey   `json:"prompts"`
+	Space         []SearchParam `json:"space"`
+	LatencyWeight float64       `json:"latencyWeight"`
+	Seed          int64         `json:"seed"`
+	Trials        []StudyTrial  `json:"trials"`
+}
+
+// LoadStudy reads a study file, or returns nil when it does not exist
+func LoadStudy(path string) (*Study, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read study: %v", err)
+	}
+	var study Study
+	if err := json.Unmarshal(data, &study); err != nil {
+		return nil, fmt.Errorf("failed to parse study %s: %v", path, err)
+	}
+	return &study, nil
+}
+
+// Save writes the study to path
+func (s *Study) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode study: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write study: %v", err)
+	}
+	return nil
+}
+
+// Best returns the completed trial with the highest objective
+func (s *Study) Best() (StudyTrial, bool) {
+	var best StudyTrial
+	found := false
+	for _, trial := range s.Trials {
+		if trial.Runs > 0 && (!found || trial.Objective > best.Objective) {
+			best, found = trial, true
+		}
+	}
+	return best, found
+}
+
+// BaseClamped reports whether the first trial differs from the base preset:
+// base values outside the space are clamped into it (or rounded to its
+// steps), and options the base leaves unset start at the middle of their
+// range.
+func (s *Study) BaseClamped() bool {
+	if len(s.Trials) == 0 {
+		return false
+	}
+	resolved := ResolveOptions(Configs[s.Base])
+	for _, p := range s.Space {
+		if v, ok := toFloat(resolved[p.Name]); !ok || v != s.Trials[0].Params[p.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// BaseLabel names the first trial in reports: the base, or the clamped
+// base when it differs from it
+func (s *Study) BaseLabel() string {
+	if s.BaseClamped() {
+		return fmt.Sprintf("clamped base %s", s.Base)
+	}
+	return string(s.Base)
+}
+
+// Config builds the preset of a trial: the base with the searched options
+// set
+func (s *Study) Config(params map[string]float64) map[string]interface{} {
+	base := Configs[s.Base]
+	config := make(map[string]interface{}, len(base)+len(s.Space))
+	for k, v := range base {
+		config[k] = v
+	}
+	for _, p := range s.Space {
+		setOption(config, p.Name, p.value(params[p.Name]))
+	}
+	return config
+}
+
+// gradedPrompts keeps the prompts with a grader, the only ones with a score
+func gradedPrompts(prompts []PromptKey) []PromptKey {
+	var graded []PromptKey
+	for _, prompt := range prompts {
+		if spec := PromptSpecs[prompt]; spec.Grader != nil || spec.Generate != nil {
+			graded = append(graded, prompt)
+		}
+	}
+	return graded
+}
+
+// RunOptimize searches the options of the space around a base preset until
+// the study holds budget trials, resuming it when the file exists. The
+// first trial evaluates the base, clamped into the space.
+func RunOptimize(opts RunOptions, path string, budget int, fresh Study) (*Study, error) {
+	if _, ok := Configs[fresh.Base]; !ok {
+		return nil, fmt.Errorf("unknown config %s", fresh.Base)
+	}
+	fresh.Prompts = gradedPrompts(fresh.Prompts)
+	if len(fresh.Prompts) == 0 {
+		return nil, fmt.Errorf("none of the prompts are graded")
+	}
+
+	study, err := LoadStudy(path)
+	if err != nil {
+		return nil, err
+	}
+	if study == nil {
+		study = &fresh
+	} else {
+		if study.Base != fresh.Base || study.Model != fresh.Model || study.LatencyWeight != fresh.LatencyWeight ||
+			!reflect.DeepEqual(study.Prompts, fresh.Prompts) || !reflect.DeepEqual(study.Space, fresh.Space) {
+			return nil, fmt.Errorf("study %s was run with another base, model, prompts, space or objective; use another -study file", path)
+		}
+		fmt.Printf("Resuming study %s at trial %d of %d\n", path, len(study.Trials)+1, budget)
+	}
+
+	for len(study.Trials) < budget {
+		number := len(study.Trials) + 1
+		params := study.suggest()
+
+		key := ConfigKey(fmt.Sprintf("%s[trial %d]", study.Base, number))
+		Configs[key] = study.Config(params)
+		fmt.Printf("\nTrial %d/%d: %s\n", number, budget, formatParams(study.Space, params))
+
+		results, err := RunTestPattern(opts, CustomTest(study.Prompts, []ConfigKey{key}))
+		if err != nil {
+			return nil, err
+		}
+
+		trial := StudyTrial{Number: number, Params: params, Timestamp: time.Now()}
+		var latency float64
+		for _, result := range results {
+			if result.Grade == nil {
+				continue
+			}
+			trial.Runs++
+			trial.Score += result.Grade.Score
+			latency += result.Metrics.ResponseTime.Seconds()
+		}
+		if trial.Runs > 0 {
+			trial.Score /= float64(trial.Runs)
+			trial.Latency = latency / float64(trial.Runs)
+			trial.Objective = trial.Score - study.LatencyWeight*trial.Latency
+		}
+		study.Trials = append(study.Trials, trial)
+		if err := study.Save(path); err != nil {
+			return nil, err
+		}
+
+		if trial.Runs == 0 {
+			fmt.Printf("Trial %d: no graded responses\n", number)
+			continue
+		}
+		best, _ := study.Best()
+		fmt.Printf("Trial %d: score %.3f, latency %.2fs, objective %.3f (best %.3f at trial %d)\n",
+			number, trial.Score, trial.Latency, trial.Objective, best.Objective, best.Number)
+	}
+
+	return study, nil
+}
+
+// suggest returns the parameters of the next trial: the base values
+// clamped into the space first, then random points, then the candidate maximizing l(x)/g(x),
+// the ratio of the Parzen densities of the good and the other trials.
+// The random source is seeded by the trial number, so a resumed study
+// makes the same suggestions.
+func (s *Study) suggest() map[string]float64 {
+	rng := rand.New(rand.NewSource(s.Seed + int64(len(s.Trials))))
+
+	if len(s.Trials) == 0 {
+		resolved := ResolveOptions(Configs[s.Base])
+		params := make(map[string]float64)
+		for _, p := range s.Space {
+			x := (p.Low + p.High) / 2
+			if v, ok := toFloat(resolved[p.Name]); ok {
+				x = math.Min(math.Max(v, p.Low), p.High)
+			}
+			params[p.Name] = p.denormalize(p.normalize(x))
+		}
+		return params
+	}
+
+	var completed []StudyTrial
+	for _, trial := range s.Trials {
+		if trial.Runs > 0 {
+			completed = append(completed, trial)
+		}
+	}
+	if len(completed) < tpeStartup {
+		params := make(map[string]float64)
+		for _, p := range s.Space {
+			params[p.Name] = p.denormalize(rng.Float64())
+		}
+		return params
+	}
+
+	sort.SliceStable(completed, func(i, j int) bool { return completed[i].Objective > completed[j].Objective })
+	good := max(1, int(math.Ceil(tpeGamma*float64(len(completed)))))
+
+	var best map[string]float64
+	bestRatio := math.Inf(-1)
+	for c := 0; c < tpeCandidates; c++ {
+		params := make(map[string]float64)
+		var ratio float64
+		for _, p := range s.Space {
+			l := newParzen(p, completed[:good])
+			g := newParzen(p, completed[good:])
+			u := l.sample(rng)
+			params[p.Name] = p.denormalize(u)
+			u = p.normalize(params[p.Name])
+			ratio += math.Log(l.density(u)) - math.Log(g.density(u))
+		}
+		if ratio > bestRatio {
+			best, bestRatio = params, ratio
+		}
+	}
+	return best
+}
+
+// parzen is a Parzen estimator over [0, 1]: a uniform prior plus one
+// Gaussian kernel per observation, each truncated to the interval
+type parzen struct {
+	points []float64
+	sigma  float64
+}
+
+func newParzen(p SearchParam, trials []StudyTrial) parzen {
+	var points []float64
+	for _, trial := range trials {
+		points = append(points, p.normalize(trial.Params[p.Name]))
+	}
+
+	// Scott's rule, bounded so a few close points do not collapse it
+	sigma := 0.25
+	if len(points) > 1 {
+		sigma = 1.06 * math.Sqrt(sumSquares(points, mean(points))/float64(len(points))) * math.Pow(float64(len(points)), -0.2)
+	}
+	return parzen{points: points, sigma: math.Min(math.Max(sigma, 0.05), 0.5)}
+}
+
+func (pz parzen) density(u float64) float64 {
+	d := 1.0
+	for _, mu := range pz.points {
+		mass := normalCDF((1-mu)/pz.sigma) - normalCDF(-mu/pz.sigma)
+		z := (u - mu) / pz.sigma
+		d += math.Exp(-z*z/2) / (pz.sigma * math.Sqrt(2*math.Pi) * mass)
+	}
+	return d / float64(len(pz.points)+1)
+}
+
+func (pz parzen) sample(rng *rand.Rand) float64 {
+	i := rng.Intn(len(pz.points) + 1)
+	if i == len(pz.points) {
+		return rng.Float64()
+	}
+	for attempt := 0; attempt < 100; attempt++ {
+		if u := pz.points[i] + pz.sigma*rng.NormFloat64(); u >= 0 && u <= 1 {
+			return u
+		}
+	}
+	return pz.points[i]
+}
+
+func normalCDF(z float64) float64 { return 0.5 * (1 + math.Erf(z/math.Sqrt2)) }
+
+func formatParams(space []SearchParam, params map[string]float64) string {
+	parts := make([]string, len(space))
+	for i, p := range space {
+		parts[i] = fmt.Sprintf("%s=%s", p.Name, formatOption(p.value(params[p.Name])))
+	}
+	return strings.Join(parts, " ")
+}
+
+// SavePreset adds the best trial of a study as a preset extending the base
+// to a suite file, keeping the presets already in it
+func SavePreset(study *Study, path, name string) error {
+	best, ok := study.Best()
+	if !ok {
+		return fmt.Errorf("no completed trials")
+	}
+
+	suite := Suite{Configs: make(map[string]SuitePreset)}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &suite); err != nil {
+			return fmt.Errorf("failed to parse suite %s: %v", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read suite: %v", err)
+	}
+
+	options := make(map[string]interface{})
+	for _, p := range study.Space {
+		options[p.Name] = p.value(best.Params[p.Name])
+	}
+	suite.Configs[name] = SuitePreset{Extends: string(study.Base), Options: options}
+
+	data, err := json.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode suite: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write suite: %v", err)
+	}
+	return nil
+}
+
+// printStudySummary lists the best trials of a study and compares the
+// best one with trial 1, the base or the clamped base
+func printStudySummary(study *Study) {
+	var completed []StudyTrial
+	for _, trial := range study.Trials {
+		if trial.Runs > 0 {
+			completed = append(completed, trial)
+		}
+	}
+	if len(completed) == 0 {
+		return
+	}
+	sort.SliceStable(completed, func(i, j int) bool { return completed[i].Objective > completed[j].Objective })
+
+	fmt.Printf("\nOptimization of %s (%s, %d prompts, %d trials, latency weight %g):\n",
+		study.Base, study.Model, len(study.Prompts), len(study.Trials), study.LatencyWeight)
+	fmt.Printf("%6s %8s %10s %10s  %s\n", "Trial", "Score", "Latency", "Objective", "Options")
+	for _, trial := range completed[:min(len(completed), 10)] {
+		fmt.Printf("%6d %8.3f %9.2fs %10.3f  %s\n", trial.Number, trial.Score, trial.Latency, trial.Objective,
+			formatParams(study.Space, trial.Params))
+	}
+
+	best := completed[0]
+	if base := study.Trials[0]; base.Runs > 0 {
+		fmt.Printf("Best trial %d: objective %.3f against %.3f for %s (trial 1, %+.3f)\n",
+			best.Number, best.Objective, base.Objective, study.BaseLabel(), best.Objective-base.Objective)
+	}
+}
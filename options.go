@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/parakeet-nest/parakeet/enums/option"
+)
+
+// OptionType is the JSON type of an Ollama option
+type OptionType string
+
+const (
+	OptionInt     OptionType = "int"
+	OptionFloat   OptionType = "float"
+	OptionBool    OptionType = "bool"
+	OptionStrings OptionType = "[]string"
+)
+
+// OptionSpec documents one Ollama runtime option. Name is the key sent to
+// the server and Key the parakeet option name presets may use instead.
+// Options with a Default are always sent, as parakeet did; the others are
+// only sent when set, leaving ServerDefault in effect.
+type OptionSpec struct {
+	Name          string
+	Key           string
+	Type          OptionType
+	Min, Max      *float64
+	Default       interface{}
+	ServerDefault string
+	Doc           string
+	// Sweep lists the values tried when the option is ablated
+	Sweep []interface{}
+}
+
+func bound(x float64) *float64 { return &x }
+
+// OptionCatalog lists every Ollama runtime option, sampling options first
+var OptionCatalog = []OptionSpec{
+	{Name: "temperature", Key: option.Temperature, Type: OptionFloat, Min: bound(0), Default: 0.8,
+		Doc: "Sampling temperature; higher is more random, 0 is greedy", Sweep: []interface{}{0.0, 0.4, 0.8, 1.2}},
+	{Name: "top_k", Key: option.TopK, Type: OptionInt, Min: bound(0), Default: 40,
+		Doc: "Sample from the k most likely tokens; 0 disables", Sweep: []interface{}{10, 40, 100}},
+	{Name: "top_p", Key: option.TopP, Type: OptionFloat, Min: bound(0), Max: bound(1), Default: 0.9,
+		Doc: "Nucleus sampling: smallest token set whose probability reaches p", Sweep: []interface{}{0.5, 0.8, 0.95, 1.0}},
+	{Name: "min_p", Type: OptionFloat, Min: bound(0), Max: bound(1), ServerDefault: "0",
+		Doc: "Drop tokens below p times the probability of the most likely one", Sweep: []interface{}{0.0, 0.05, 0.1}},
+	{Name: "typical_p", Key: option.TypicalP, Type: OptionFloat, Min: bound(0), Max: bound(1), Default: 1.0,
+		Doc: "Locally typical sampling; 1 disables"},
+	{Name: "tfs_z", Key: option.TFSZ, Type: OptionFloat, Min: bound(0), Default: 1.0,
+		Doc: "Tail-free sampling; 1 disables (ignored by recent servers)"},
+	{Name: "repeat_penalty", Key: option.RepeatPenalty, Type: OptionFloat, Min: bound(0), Default: 1.1,
+		Doc: "Penalty on tokens seen in the last repeat_last_n; 1 disables", Sweep: []interface{}{1.0, 1.1, 1.3}},
+	{Name: "repeat_last_n", Key: option.RepeatLastN, Type: OptionInt, Min: bound(-1), Default: 64,
+		Doc: "Tokens looked back for repetition penalties; 0 disables, -1 is num_ctx", Sweep: []interface{}{0, 64, 256}},
+	{Name: "presence_penalty", Key: option.PresencePenalty, Type: OptionFloat, Min: bound(-2), Max: bound(2), Default: 0.0,
+		Doc: "Flat penalty on tokens that already appeared", Sweep: []interface{}{0.0, 0.5, 1.0}},
+	{Name: "frequency_penalty", Key: option.FrequencyPenalty, Type: OptionFloat, Min: bound(-2), Max: bound(2), Default: 0.0,
+		Doc: "Penalty growing with how often a token appeared", Sweep: []interface{}{0.0, 0.5, 1.0}},
+	{Name: "penalize_newline", Key: option.PenalizeNewline, Type: OptionBool, Default: true,
+		Doc: "Apply the repetition penalties to newlines"},
+	{Name: "mirostat", Key: option.Mirostat, Type: OptionInt, Min: bound(0), Max: bound(2), Default: 0,
+		Doc: "Mirostat perplexity control: 0 off, 1 Mirostat, 2 Mirostat 2.0", Sweep: []interface{}{0, 1, 2}},
+	{Name: "mirostat_tau", Key: option.MirostatTau, Type: OptionFloat, Min: bound(0), Default: 5.0,
+		Doc: "Mirostat target surprise; lower is more focused", Sweep: []interface{}{2.0, 5.0, 8.0}},
+	{Name: "mirostat_eta", Key: option.MirostatEta, Type: OptionFloat, Min: bound(0), Max: bound(1), Default: 0.1,
+		Doc: "Mirostat learning rate", Sweep: []interface{}{0.05, 0.1, 0.3}},
+	{Name: "seed", Key: option.Seed, Type: OptionInt, Default: -1,
+		Doc: "Sampling seed; -1 picks a random one"},
+	{Name: "stop", Key: option.Stop, Type: OptionStrings, ServerDefault: "model template",
+		Doc: "Sequences that end generation when produced"},
+	{Name: "num_predict", Key: option.NumPredict, Type: OptionInt, Min: bound(-2), Default: -1,
+		Doc: "Maximum tokens to generate; -1 unlimited, -2 until the context is full"},
+	{Name: "num_keep", Key: option.NumKeep, Type: OptionInt, Min: bound(-1), Default: 4,
+		Doc: "Prompt tokens kept when the context shifts; -1 keeps all"},
+	{Name: "num_ctx", Type: OptionInt, Min: bound(1), ServerDefault: "model-dependent",
+		Doc: "Context window in tokens"},
+	{Name: "num_batch", Type: OptionInt, Min: bound(1), ServerDefault: "512",
+		Doc: "Prompt tokens processed per batch"},
+	{Name: "num_gpu", Type: OptionInt, Min: bound(-1), ServerDefault: "automatic",
+		Doc: "Layers offloaded to the GPU; 0 runs on the CPU"},
+	{Name: "main_gpu", Type: OptionInt, Min: bound(0), ServerDefault: "0",
+		Doc: "GPU holding small tensors when several are used"},
+	{Name: "num_thread", Type: OptionInt, Min: bound(0), ServerDefault: "automatic",
+		Doc: "CPU threads; 0 lets the server decide"},
+	{Name: "use_mmap", Type: OptionBool, ServerDefault: "automatic",
+		Doc: "Memory-map the model file instead of loading it"},
+	{Name: "use_mlock", Type: OptionBool, ServerDefault: "false",
+		Doc: "Lock the model in RAM so it is not swapped out"},
+	{Name: "numa", Type: OptionBool, ServerDefault: "false",
+		Doc: "Enable NUMA-aware allocation"},
+	{Name: "low_vram", Type: OptionBool, ServerDefault: "false",
+		Doc: "Reduce VRAM use at some speed cost (ignored by recent servers)"},
+}
+
+// LookupOption finds an option by its Ollama name or parakeet key
+func LookupOption(key string) (OptionSpec, bool) {
+	for _, spec := range OptionCatalog {
+		if key == spec.Name || (spec.Key != "" && key == spec.Key) {
+			return spec, true
+		}
+	}
+	return OptionSpec{}, false
+}
+
+// Coerce converts a value to the option's type: integral floats (decoded
+// JSON) to ints, ints to floats, and string lists from []interface{}.
+func (spec OptionSpec) Coerce(value interface{}) (interface{}, error) {
+	switch spec.Type {
+	case OptionInt:
+		switch v := value.(type) {
+		case int:
+			return v, nil
+		case int64:
+			return int(v), nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int(v), nil
+			}
+		}
+	case OptionFloat:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case float32:
+			return float64(v), nil
+		case int:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		}
+	case OptionBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+	case OptionStrings:
+		switch v := value.(type) {
+		case []string:
+			return v, nil
+		case string:
+			return []string{v}, nil
+		case []interface{}:
+			sequences := make([]string, 0, len(v))
+			for _, s := range v {
+				s, ok := s.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: expected strings, got %T", spec.Name, s)
+				}
+				sequences = append(sequences, s)
+			}
+			return sequences, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: expected %s, got %T %v", spec.Name, spec.Type, value, value)
+}
+
+// ParseValue parses a command-line value for the option. String lists are
+// separated by "|".
+func (spec OptionSpec) ParseValue(text string) (interface{}, error) {
+	switch spec.Type {
+	case OptionInt:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected an integer, got %q", spec.Name, text)
+		}
+		return n, nil
+	case OptionFloat:
+		x, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected a number, got %q", spec.Name, text)
+		}
+		return x, nil
+	case OptionBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: expected true or false, got %q", spec.Name, text)
+		}
+		return b, nil
+	}
+	return strings.Split(text, "|"), nil
+}
+
+// Check coerces a value and checks it against the option's range
+func (spec OptionSpec) Check(value interface{}) (interface{}, error) {
+	v, err := spec.Coerce(value)
+	if err != nil {
+		return nil, err
+	}
+	var x float64
+	switch v := v.(type) {
+	case int:
+		x = float64(v)
+	case float64:
+		x = v
+	default:
+		return v, nil
+	}
+	if math.IsNaN(x) || (spec.Min != nil && x < *spec.Min) || (spec.Max != nil && x > *spec.Max) {
+		return nil, fmt.Errorf("%s: %v out of range %s", spec.Name, x, spec.Range())
+	}
+	return v, nil
+}
+
+// Range describes the valid values of the option
+func (spec OptionSpec) Range() string {
+	switch {
+	case spec.Min != nil && spec.Max != nil:
+		return fmt.Sprintf("[%g, %g]", *spec.Min, *spec.Max)
+	case spec.Min != nil:
+		return fmt.Sprintf(">= %g", *spec.Min)
+	case spec.Max != nil:
+		return fmt.Sprintf("<= %g", *spec.Max)
+	}
+	return "-"
+}
+
+// ValidateOptions checks every option of a preset: known name, type and
+// range. It returns one error per problem.
+func ValidateOptions(config map[string]interface{}) []error {
+	var errs []error
+	seen := make(map[string]string)
+	for _, key := range sortedKeys(config) {
+		spec, ok := LookupOption(key)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown option %q", key))
+			continue
+		}
+		if other, ok := seen[spec.Name]; ok {
+			errs = append(errs, fmt.Errorf("%s is set twice, as %q and %q", spec.Name, other, key))
+		}
+		seen[spec.Name] = key
+		if _, err := spec.Check(config[key]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// ValidateConfigs checks every preset and returns the problems found,
+// prefixed with the preset name.
+func ValidateConfigs() []error {
+	var errs []error
+	for _, key := range sortedKeys(Configs) {
+		for _, err := range ValidateOptions(Configs[key]) {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+	}
+	return errs
+}
+
+// ResolveOptions merges a preset over the catalog defaults and returns the
+// options keyed by their Ollama names. Invalid values are left out; they
+// are reported by ValidateConfigs.
+func ResolveOptions(config map[string]interface{}) map[string]interface{} {
+	options := make(map[string]interface{})
+	for _, spec := range OptionCatalog {
+		if spec.Default != nil {
+			options[spec.Name] = spec.Default
+		}
+	}
+	for key, value := range config {
+		spec, ok := LookupOption(key)
+		if !ok {
+			continue
+		}
+		if v, err := spec.Check(value); err == nil {
+			options[spec.Name] = v
+		}
+	}
+	return options
+}
+
+// presetValue returns the value a preset sets for an option, under either
+// of its names
+func presetValue(config map[string]interface{}, name string) (interface{}, bool) {
+	for key, value := range config {
+		if spec, ok := LookupOption(key); ok && spec.Name == name {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// formatOption renders an option value for tables
+func formatOption(value interface{}) string {
+	if sequences, ok := value.([]string); ok {
+		return fmt.Sprintf("%q", sequences)
+	}
+	return fmt.Sprint(value)
+}
+
+// RunConfigsCommand lists the presets, or with "show NAME" renders the
+// resolved options of one preset with their source, range and docs.
+func RunConfigsCommand(args []string) error {
+	if len(args) == 0 {
+		invalid := 0
+		for _, key := range sortedKeys(Configs) {
+			fmt.Printf("%-20s %d options", key, len(Configs[key]))
+			if errs := ValidateOptions(Configs[key]); len(errs) > 0 {
+				fmt.Printf(", %d invalid", len(errs))
+				invalid++
+			}
+			fmt.Printf("\n")
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%d presets have invalid options (configs show NAME lists them)", invalid)
+		}
+		return nil
+	}
+	if args[0] != "show" || len(args) != 2 {
+		return fmt.Errorf("usage: configs [show NAME]")
+	}
+
+	key := ConfigKey(args[1])
+	config, ok := Configs[key]
+	if !ok {
+		return fmt.Errorf("invalid config key: %s", args[1])
+	}
+
+	resolved := ResolveOptions(config)
+	fmt.Printf("%s\n\n", key)
+	fmt.Printf("%-18s %-10s %-8s %-28s %-10s %s\n", "Option", "Type", "Source", "Value", "Range", "Description")
+	for _, spec := range OptionCatalog {
+		value, source := "", "default"
+		if v, ok := resolved[spec.Name]; ok {
+			value = formatOption(v)
+		}
+		if raw, ok := presetValue(config, spec.Name); ok {
+			source = "preset"
+			// ResolveOptions leaves invalid values out, so show what the
+			// preset set rather than the default sent in its place
+			if _, err := spec.Check(raw); err != nil {
+				source, value = "invalid", formatOption(raw)
+			}
+		} else if spec.Default == nil {
+			source = "server"
+			value = spec.ServerDefault
+		}
+		fmt.Printf("%-18s %-10s %-8s %-28s %-10s %s\n", spec.Name, spec.Type, source, value, spec.Range(), spec.Doc)
+	}
+
+	if errs := ValidateOptions(config); len(errs) > 0 {
+		fmt.Printf("\nInvalid options:\n")
+		for _, err := range errs {
+			fmt.Printf("- %v\n", err)
+		}
+		return fmt.Errorf("%s fails validation; runs with it are refused", key)
+	}
+	return nil
+}
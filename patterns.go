@@ -26,6 +26,13 @@ const (
 	PatternAdvMath    PatternKey = "advanced-math"
 	PatternHumanities PatternKey = "humanities"
 	PatternGameTheory PatternKey = "game-theory"
+	PatternStructured PatternKey = "structured"
+	PatternTools      PatternKey = "tools"
+	PatternCode       PatternKey = "code"
+	PatternVision     PatternKey = "vision"
+	PatternRAG        PatternKey = "rag"
+	PatternGenerated  PatternKey = "generated"
+	PatternIFEval     PatternKey = "instructions"
 )
 
 func CustomTest(prompts []PromptKey, configs []ConfigKey) TestPattern {
@@ -176,6 +183,70 @@ func GameTheoryTest(configs []ConfigKey) TestPattern {
 	}
 }
 
+func StructuredOutputTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptExtractContact, PromptExtractOrder,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func ToolCallingTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptToolCalculator, PromptToolWeather, PromptToolChain,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func CodeGenerationTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptCodeReverseWords, PromptCodeIsPalindrome, PromptCodeMergeIntervals,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func VisionTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptVisionCount, PromptVisionColor, PromptVisionOCR,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func RAGTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptRAGCarryOver, PromptRAGRemoteBudget, PromptRAGErrorCode,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func GeneratedTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptGenLetterCount, PromptGenClockAngle, PromptGenDice, PromptGenPercentage, PromptGenSyllogism,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
+func InstructionFollowingTest(configs []ConfigKey) TestPattern {
+	return TestPattern{
+		prompts: []PromptKey{
+			PromptExpansion, PromptCompression, PromptMultiLingual,
+			PromptIFLowercase, PromptIFJSONList, PromptIFKeywords,
+		},
+		configs: map[bool][]ConfigKey{true: configs, false: AllConfigs()}[len(configs) > 0],
+	}
+}
+
 var PatternMap = map[PatternKey]func([]ConfigKey) TestPattern{
 	PatternLanguage:   LanguageTest,
 	PatternMathLogic:  MathAndLogicTest,
@@ -188,6 +259,13 @@ var PatternMap = map[PatternKey]func([]ConfigKey) TestPattern{
 	PatternAdvMath:    AdvancedMathTest,
 	PatternHumanities: HumanitiesTest,
 	PatternGameTheory: GameTheoryTest,
+	PatternStructured: StructuredOutputTest,
+	PatternTools:      ToolCallingTest,
+	PatternCode:       CodeGenerationTest,
+	PatternVision:     VisionTest,
+	PatternRAG:        RAGTest,
+	PatternGenerated:  GeneratedTest,
+	PatternIFEval:     InstructionFollowingTest,
 }
 
 // GetAllPatterns returns all available pattern keys
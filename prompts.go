@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
 	"strings"
 )
 
@@ -88,6 +90,42 @@ const (
 
 	// Chain of thought
 	PromptCoT PromptKey = "cot"
+
+	// Structured Output
+	PromptExtractContact PromptKey = "extract_contact"
+	PromptExtractOrder   PromptKey = "extract_order"
+
+	// Tool Calling
+	PromptToolCalculator PromptKey = "tool_calculator"
+	PromptToolWeather    PromptKey = "tool_weather"
+	PromptToolChain      PromptKey = "tool_chain"
+
+	// Code Generation
+	PromptCodeReverseWords   PromptKey = "code_reverse_words"
+	PromptCodeIsPalindrome   PromptKey = "code_is_palindrome"
+	PromptCodeMergeIntervals PromptKey = "code_merge_intervals"
+
+	// Vision
+	PromptVisionCount PromptKey = "vision_count"
+	PromptVisionColor PromptKey = "vision_color"
+	PromptVisionOCR   PromptKey = "vision_ocr"
+
+	// Retrieval-Augmented QA
+	PromptRAGCarryOver    PromptKey = "rag_carryover"
+	PromptRAGRemoteBudget PromptKey = "rag_remote_budget"
+	PromptRAGErrorCode    PromptKey = "rag_error_code"
+
+	// Generated (fresh instances with computed answers for every run)
+	PromptGenLetterCount PromptKey = "gen_letter_count"
+	PromptGenClockAngle  PromptKey = "gen_clock_angle"
+	PromptGenDice        PromptKey = "gen_dice"
+	PromptGenPercentage  PromptKey = "gen_percentage"
+	PromptGenSyllogism   PromptKey = "gen_syllogism"
+
+	// Instruction Following
+	PromptIFLowercase PromptKey = "if_lowercase"
+	PromptIFJSONList  PromptKey = "if_json_list"
+	PromptIFKeywords  PromptKey = "if_keywords"
 )
 
 var TestPrompts = map[PromptKey]string{
@@ -132,7 +170,7 @@ var TestPrompts = map[PromptKey]string{
 	PromptArtAnalysis:     `Analyze the use of perspective, light, and symbolism in Vermeer's "Girl with a Pearl Earring". How do these elements contribute to the painting's impact?`,
 	PromptGameStrategy:    `In a game of prisoner's dilemma repeated 100 times, what would be the optimal strategy? Consider both theoretical and practical aspects.`,
 	PromptGameTheory:      `Explain how Nash Equilibrium applies to market competition between two companies setting prices for similar products.`,
-	PromptExpansion:       `Write the first two paragraphs of a blog post explaining quantum computing to teenagers. The post should start with an engaging hook and use relatable examples from their daily lives. Begin with the title 'Quantum Computing: Your Phone's Future Superpower?'`,
+	PromptExpansion:       `Write the first two paragraphs of a blog post explaining quantum computing to teenagers. The post should start with an engaging hook and use relatable examples from their daily lives. Begin with the title '` + expansionTitle + `'`,
 	PromptCompression: `Summarize the following passage into three key points while maintaining the core message:
 The Industrial Revolution, which took place from the 18th to 19th centuries, was a period of significant technological, socioeconomic, and cultural change. This transformation began in Great Britain and quickly spread throughout Western Europe and North America. The transition included going from manual production methods to machines, new chemical manufacturing and iron production processes, improved efficiency of water power, the increasing use of steam power, and the development of machine tools. It also included the change from wood and other biofuels to coal. The textile industry was the first to adopt such changes, as cotton spinning was mechanized. The Industrial Revolution marked a major turning point in human history, as almost every aspect of daily life was influenced in some way. It influenced the manufacture of new types of tools, the rise of the factory system, and important technological innovations in transportation and communication methods.`,
 	PromptConversion: `Convert the following natural language query into a proper SQL query. The database has tables for 'employees' (columns: employee_id, name, department, salary, hire_date) and 'departments' (columns: department_id, department_name, location):
@@ -166,6 +204,250 @@ Model B:
 - Market growth: 15% annually
 Which business model should they choose? Provide your analysis and recommendation based on profitability, scalability, and long-term sustainability. Show your calculations and reasoning.`,
 	PromptCoT: `How many times does the letter 'r' appear in the word 'strawberry'?`,
+	PromptExtractContact: `Extract the contact details from this email signature as JSON:
+Best regards,
+Maria Gonzalez
+Senior Data Engineer, Northwind Analytics
+maria.gonzalez@northwind.example | +1 555 0142`,
+	PromptExtractOrder: `Extract the order from this message as JSON:
+Hi, I'd like to order 3 blue notebooks at $4.50 each and 2 black pens at $1.25 each. Please ship them to Lisbon.`,
+	PromptToolCalculator: "What is 1234 multiplied by 5678? Use the calculator tool.",
+	PromptToolWeather:    "What's the weather like in Paris right now? Should I take an umbrella?",
+	PromptToolChain:      "Look up the key 'office:E-1042' in the key-value store to find the city where employee E-1042 works, then tell me the current weather there.",
+	PromptCodeReverseWords: codePrompt("func ReverseWords(s string) string",
+		"returns the words of s in reverse order, separated by single spaces, ignoring leading, trailing and repeated whitespace"),
+	PromptCodeIsPalindrome: codePrompt("func IsPalindrome(s string) bool",
+		"reports whether s reads the same forwards and backwards, considering only letters and digits and ignoring case"),
+	PromptCodeMergeIntervals: codePrompt("func MergeIntervals(intervals [][2]int) [][2]int",
+		"merges all overlapping or touching closed intervals and returns them sorted by start"),
+	PromptVisionCount:     "How many circles are in this image? Answer with a number.",
+	PromptVisionColor:     "What color is the square in this image?",
+	PromptVisionOCR:       "What text is written in this image? Transcribe it exactly.",
+	PromptRAGCarryOver:    "How many unused vacation days can a Northwind Analytics employee carry over to the next year, and when do they expire?",
+	PromptRAGRemoteBudget: "What home office budget do remote employees at Northwind Analytics receive, and what does it cover?",
+	PromptRAGErrorCode:    "What does error E4 mean on the Aurora X2 thermostat?",
+	PromptGenLetterCount:  "[generated] How many times does a letter appear in a random word?",
+	PromptGenClockAngle:   "[generated] What is the angle between the hands of a clock at a random time?",
+	PromptGenDice:         "[generated] What is the exact probability of a random dice event?",
+	PromptGenPercentage:   "[generated] Percentage arithmetic with exact decimal answers",
+	PromptGenSyllogism:    "[generated] Is a conclusion valid given two premises over nonsense terms?",
+	PromptIFLowercase:     "Describe your favorite season in fewer than 60 words. Write entirely in lowercase letters and do not use any commas.",
+	PromptIFJSONList:      "List the three primary colors of light as a JSON array of strings. Output only the JSON, with no explanation.",
+	PromptIFKeywords:      "Write a short product description for a reusable water bottle in exactly 3 bullet points. Mention the words 'insulated', 'leak-proof' and 'dishwasher'.",
+}
+
+// ragDocuments is the document set retrieved from by the RAG prompts
+// expansionTitle is the title the expansion prompt asks for
+const expansionTitle = "Quantum Computing: Your Phone's Future Superpower?"
+
+var ragDocuments = []string{"corpora/rag/handbook.md", "corpora/rag/thermostat.md"}
+
+// codePrompt asks for a Go function with a fixed signature so it can be
+// compiled against hidden tests.
+func codePrompt(signature, behavior string) string {
+	return fmt.Sprintf("Write a Go function with the signature `%s` that %s. "+
+		"Reply with the complete code, including any imports, in a single ```go code block.", signature, behavior)
+}
+
+// PromptSpec holds optional evaluation metadata attached to a prompt
+type PromptSpec struct {
+	// Schema is a JSON Schema the response must satisfy
+	Schema json.RawMessage
+	// Expected is the reference value used for field-level accuracy
+	Expected interface{}
+
+	// Tools names the mock tools offered to the model through /api/chat
+	Tools []string
+	// ExpectedCalls is the tool-call sequence the model should make
+	ExpectedCalls []ExpectedToolCall
+	// ExpectedAnswer must appear (case-insensitively) in the final answer;
+	// numbers may be written with digit-group separators
+	ExpectedAnswer string
+
+	// Images lists local image files sent with the prompt to vision models
+	Images []string
+
+	// Documents lists local files chunked, embedded and retrieved from to
+	// build the prompt; the prompt text is the question
+	Documents []string
+
+	// Grader scores the response against a reference answer
+	Grader Grader
+
+	// Generate replaces the prompt text with seeded instances that carry
+	// their own answer and grader
+	Generate Generator
+
+	// Constraints are verifiable instructions checked on every response
+	Constraints []Constraint
+}
+
+// PromptSpecs declares the prompts that carry evaluation metadata
+var PromptSpecs = map[PromptKey]PromptSpec{
+	PromptExtractContact: {
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"name": {"type": "string"},
+				"title": {"type": "string"},
+				"company": {"type": "string"},
+				"email": {"type": "string", "pattern": "^[^@\\s]+@[^@\\s]+$"},
+				"phone": {"type": "string"}
+			},
+			"required": ["name", "title", "company", "email", "phone"],
+			"additionalProperties": false
+		}`),
+		Expected: map[string]interface{}{
+			"name":    "Maria Gonzalez",
+			"title":   "Senior Data Engineer",
+			"company": "Northwind Analytics",
+			"email":   "maria.gonzalez@northwind.example",
+			"phone":   "+1 555 0142",
+		},
+	},
+	PromptExtractOrder: {
+		Schema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"items": {
+					"type": "array",
+					"minItems": 1,
+					"items": {
+						"type": "object",
+						"properties": {
+							"product": {"type": "string"},
+							"quantity": {"type": "integer", "minimum": 1},
+							"unit_price": {"type": "number", "minimum": 0}
+						},
+						"required": ["product", "quantity", "unit_price"]
+					}
+				},
+				"total": {"type": "number"},
+				"city": {"type": "string"}
+			},
+			"required": ["items", "total", "city"]
+		}`),
+		Expected: map[string]interface{}{
+			"items": []interface{}{
+				map[string]interface{}{"product": "blue notebook", "quantity": 3.0, "unit_price": 4.5},
+				map[string]interface{}{"product": "black pen", "quantity": 2.0, "unit_price": 1.25},
+			},
+			"total": 16.0,
+			"city":  "Lisbon",
+		},
+	},
+	PromptExpansion: {
+		Constraints: []Constraint{
+			StartsWith{Text: expansionTitle},
+			ParagraphCount{Min: 2, Max: 2, Title: expansionTitle},
+			IncludeKeywords{Keywords: []string{"quantum"}},
+		},
+	},
+	PromptCompression: {
+		Constraints: []Constraint{
+			BulletCount{Min: 3, Max: 3},
+		},
+	},
+	PromptMultiLingual: {
+		Constraints: []Constraint{Language{Code: "es"}},
+	},
+	PromptTranslation: {
+		Constraints: []Constraint{
+			ContainsLanguages{Codes: []string{"fr", "ja", "ar"}},
+			ContainsScripts{Scripts: []string{"Japanese", "Arabic"}},
+		},
+	},
+	PromptIFLowercase: {
+		Constraints: []Constraint{AllLowercase{}, NoCommas{}, WordCount{Max: 59}},
+	},
+	PromptIFJSONList: {
+		Constraints: []Constraint{JSONOnly{}},
+	},
+	PromptIFKeywords: {
+		Constraints: []Constraint{
+			BulletCount{Min: 3, Max: 3},
+			IncludeKeywords{Keywords: []string{"insulated", "leak-proof", "dishwasher"}},
+		},
+	},
+	PromptMathLogic:   {Grader: ExactGrader{Answers: []*big.Rat{mustRat("7.5")}}},
+	PromptProbability: {Grader: ExactGrader{Answers: []*big.Rat{mustRat("1/36")}}},
+	// Margins: Q1 21.7%, Q2 25%, Q3 22.6%, Q4 24.1%; the working names every
+	// quarter, so the answer is read from the conclusion
+	PromptSeeker: {Grader: ChoiceGrader{Answer: "Q2", Choices: []string{"Q1", "Q2", "Q3", "Q4"}, Final: true}},
+	PromptMathOptimal: {
+		// Profit 40A + 50B, labor 2A + 3B ≤ 100, material 3A + 2B ≤ 120
+		Grader: LPGrader{
+			Program: LinearProgram{
+				Variables: []string{"A", "B"},
+				Objective: []string{"40", "50"},
+				Constraints: []LPConstraint{
+					{Coefficients: []string{"2", "3"}, Bound: "100"},
+					{Coefficients: []string{"3", "2"}, Bound: "120"},
+				},
+			},
+			ObjectiveLabel: "profit",
+		},
+	},
+	PromptConversion: {
+		Grader: SQLGrader{
+			Fixture:   EmployeesFixture,
+			Reference: "SELECT * FROM employees WHERE department = 'Marketing' AND salary > 60000 ORDER BY hire_date DESC",
+		},
+	},
+	PromptCodeReverseWords:   {Grader: CodeGrader{Tests: reverseWordsTests}},
+	PromptCodeIsPalindrome:   {Grader: CodeGrader{Tests: isPalindromeTests}},
+	PromptCodeMergeIntervals: {Grader: CodeGrader{Tests: mergeIntervalsTests}},
+	PromptVisionCount: {
+		Images: []string{"images/shapes_count.png"},
+		Grader: KeywordGrader{Any: []string{"4", "four"}},
+	},
+	PromptVisionColor: {
+		Images: []string{"images/color_square.png"},
+		Grader: KeywordGrader{All: []string{"red"}},
+	},
+	PromptVisionOCR: {
+		Images: []string{"images/ocr_text.png"},
+		Grader: KeywordGrader{All: []string{"SALE", "42%", "OFF"}},
+	},
+	PromptRAGCarryOver: {
+		Documents: ragDocuments,
+		Grader:    KeywordGrader{All: []string{"March 31"}, Any: []string{"5", "five"}},
+	},
+	PromptRAGRemoteBudget: {
+		Documents: ragDocuments,
+		Grader:    KeywordGrader{All: []string{"750"}, Any: []string{"desk", "chair", "monitor"}},
+	},
+	PromptRAGErrorCode: {
+		Documents: ragDocuments,
+		Grader:    KeywordGrader{All: []string{"power"}, Any: []string{"C-wire", "C wire", "common wire"}},
+	},
+	PromptGenLetterCount: {Generate: generateLetterCount},
+	PromptGenClockAngle:  {Generate: generateClockAngle},
+	PromptGenDice:        {Generate: generateDice},
+	PromptGenPercentage:  {Generate: generatePercentage},
+	PromptGenSyllogism:   {Generate: generateSyllogism},
+	PromptToolCalculator: {
+		Tools: []string{"calculator"},
+		ExpectedCalls: []ExpectedToolCall{
+			{Name: "calculator", Arguments: map[string]interface{}{"operation": "multiply", "a": 1234.0, "b": 5678.0}},
+		},
+		ExpectedAnswer: "7006652",
+	},
+	PromptToolWeather: {
+		Tools: []string{"calculator", "get_weather"},
+		ExpectedCalls: []ExpectedToolCall{
+			{Name: "get_weather", Arguments: map[string]interface{}{"city": "Paris"}},
+		},
+		ExpectedAnswer: "rain",
+	},
+	PromptToolChain: {
+		Tools: []string{"kv_lookup", "get_weather"},
+		ExpectedCalls: []ExpectedToolCall{
+			{Name: "kv_lookup", Arguments: map[string]interface{}{"key": "office:E-1042"}},
+			{Name: "get_weather", Arguments: map[string]interface{}{"city": "Oslo"}},
+		},
+		ExpectedAnswer: "snow",
+	},
 }
 
 // Get all prompts as a slice
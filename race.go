@@ -0,0 +1,222 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// RaceStanding is a config's mean grader score over the prompts it has run
+// so far in a race
+type RaceStanding struct {
+	Config     ConfigKey `json:"config"`
+	Score      float64   `json:"score"`
+	Latency    float64   `json:"latency"`
+	Runs       int       `json:"runs"`
+	Eliminated bool      `json:"eliminated"`
+}
+
+// RaceRound is one round of successive halving: the surviving configs,
+// ranked on the first Prompts prompts
+type RaceRound struct {
+	Round     int            `json:"round"`
+	Prompts   int            `json:"prompts"`
+	Standings []RaceStanding `json:"standings"`
+}
+
+// RaceResult reports a race, with the runs and response time it took
+// against the full matrix of every config on every prompt. The full
+// matrix time is estimated from the mean time of each prompt.
+type RaceResult struct {
+	Model     string        `json:"model"`
+	Configs   []ConfigKey   `json:"configs"`
+	Prompts   []PromptKey   `json:"prompts"`
+	Rounds    []RaceRound   `json:"rounds"`
+	Winner    ConfigKey     `json:"winner"`
+	Runs      int           `json:"runs"`
+	FullRuns  int           `json:"fullRuns"`
+	Time      time.Duration `json:"time"`
+	FullTime  time.Duration `json:"fullTime"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// RunRace races configs by successive halving: every config runs on the
+// first start prompts, the drop fraction with the lowest scores is
+// eliminated, and the survivors run on twice as many prompts, until one
+// is left or every prompt has run, when the best one wins. Prompts are
+// the graded ones, shuffled with the seed.
+func RunRace(opts RunOptions, prompts []PromptKey, configs []ConfigKey, start int, drop float64) (*RaceResult, error) {
+	prompts = gradedPrompts(prompts)
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("none of the prompts are graded")
+	}
+	if len(configs) < 2 {
+		return nil, fmt.Errorf("a race needs at least 2 configs")
+	}
+	if start < 1 || drop <= 0 || drop >= 1 {
+		return nil, fmt.Errorf("the start must be at least 1 prompt and the drop fraction between 0 and 1")
+	}
+
+	prompts = append([]PromptKey(nil), prompts...)
+	rng := rand.New(rand.NewSource(opts.Seed))
+	rng.Shuffle(len(prompts), func(i, j int) { prompts[i], prompts[j] = prompts[j], prompts[i] })
+
+	race := &RaceResult{Model: opts.Model, Configs: configs, Prompts: prompts}
+
+	var results []TestResult
+	alive := configs
+	ran := 0
+	for n, round := start, 1; ; n, round = n*2, round+1 {
+		n = min(n, len(prompts))
+		fmt.Printf("\nRound %d: %d configs on %d prompts\n", round, len(alive), n)
+		batch, err := RunTestPattern(opts, CustomTest(prompts[ran:n], alive))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, batch...)
+		ran = n
+
+		standings := raceStandings(results, alive)
+		if n == len(prompts) {
+			race.Rounds = append(race.Rounds, RaceRound{Round: round, Prompts: n, Standings: standings})
+			race.Winner = standings[0].Config
+			break
+		}
+
+		out := min(max(1, int(float64(len(standings))*drop)), len(standings)-1)
+		alive = nil
+		for i := range standings {
+			if i >= len(standings)-out {
+				standings[i].Eliminated = true
+			} else {
+				alive = append(alive, standings[i].Config)
+			}
+		}
+		race.Rounds = append(race.Rounds, RaceRound{Round: round, Prompts: n, Standings: standings})
+		if len(alive) == 1 {
+			race.Winner = alive[0]
+			break
+		}
+	}
+
+	// The full matrix runs every config as many times per prompt as the
+	// configs that did run it, taking their mean time. Prompts left when
+	// one config remained take the mean over the prompts that ran.
+	type cost struct {
+		runs    int
+		time    time.Duration
+		configs map[ConfigKey]bool
+	}
+	byPrompt := make(map[PromptKey]*cost)
+	for _, result := range results {
+		c, ok := byPrompt[result.Prompt]
+		if !ok {
+			c = &cost{configs: make(map[ConfigKey]bool)}
+			byPrompt[result.Prompt] = c
+		}
+		c.runs++
+		c.time += result.Metrics.ResponseTime
+		c.configs[result.Config] = true
+		race.Runs++
+		race.Time += result.Metrics.ResponseTime
+	}
+	var fullRuns, fullTime float64
+	for _, c := range byPrompt {
+		scale := float64(len(configs)) / float64(len(c.configs))
+		fullRuns += float64(c.runs) * scale
+		fullTime += float64(c.time) * scale
+	}
+	if len(byPrompt) > 0 {
+		scale := float64(len(prompts)) / float64(len(byPrompt))
+		fullRuns *= scale
+		fullTime *= scale
+	}
+	race.FullRuns = int(fullRuns + 0.5)
+	race.FullTime = time.Duration(fullTime)
+	race.Timestamp = time.Now()
+
+	return race, nil
+}
+
+// raceStandings ranks configs by mean grader score, then by mean latency
+func raceStandings(results []TestResult, configs []ConfigKey) []RaceStanding {
+	standings := make([]RaceStanding, len(configs))
+	index := make(map[ConfigKey]int)
+	for i, config := range configs {
+		standings[i].Config = config
+		index[config] = i
+	}
+	for _, result := range results {
+		i, ok := index[result.Config]
+		if !ok || result.Grade == nil {
+			continue
+		}
+		standings[i].Runs++
+		standings[i].Score += result.Grade.Score
+		standings[i].Latency += result.Metrics.ResponseTime.Seconds()
+	}
+	for i := range standings {
+		if standings[i].Runs > 0 {
+			standings[i].Score /= float64(standings[i].Runs)
+			standings[i].Latency /= float64(standings[i].Runs)
+		}
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		return standings[i].Latency < standings[j].Latency
+	})
+	return standings
+}
+
+// printRaceSummary prints the standings of every round, the elimination
+// tree and the compute saved against the full matrix
+func printRaceSummary(race *RaceResult) {
+	fmt.Printf("\nRace of %d configs over %d prompts (%s):\n", len(race.Configs), len(race.Prompts), race.Model)
+	for _, round := range race.Rounds {
+		fmt.Printf("Round %d (%d prompts):\n", round.Round, round.Prompts)
+		for _, s := range round.Standings {
+			mark := ""
+			if s.Eliminated {
+				mark = "  eliminated"
+			}
+			fmt.Printf("  %-24s %6.3f %8.2fs %5d runs%s\n", s.Config, s.Score, s.Latency, s.Runs, mark)
+		}
+	}
+
+	// Each round branches off the eliminated configs and nests the next
+	// round, down to the winner
+	fmt.Printf("\nElimination tree:\n")
+	indent := ""
+	for i, round := range race.Rounds {
+		if i == 0 {
+			fmt.Printf("Round %d: %d configs, %d prompts\n", round.Round, len(round.Standings), round.Prompts)
+		}
+		final := i == len(race.Rounds)-1
+		for j := len(round.Standings) - 1; j >= 0; j-- {
+			s := round.Standings[j]
+			switch {
+			case s.Eliminated:
+				fmt.Printf("%s├─ %-24s %6.3f  out\n", indent, s.Config, s.Score)
+			case final && j > 0:
+				fmt.Printf("%s├─ %-24s %6.3f  runner-up\n", indent, s.Config, s.Score)
+			case final:
+				fmt.Printf("%s└─ %-24s %6.3f  winner\n", indent, s.Config, s.Score)
+			}
+		}
+		if !final {
+			next := race.Rounds[i+1]
+			fmt.Printf("%s└─ Round %d: %d configs, %d prompts\n", indent, next.Round, len(next.Standings), next.Prompts)
+			indent += "   "
+		}
+	}
+	fmt.Printf("\n")
+
+	if race.FullRuns > 0 {
+		fmt.Printf("Compute: %d of %d runs of the full matrix (%.0f%% saved), %v of an estimated %v\n",
+			race.Runs, race.FullRuns, 100*(1-float64(race.Runs)/float64(race.FullRuns)),
+			race.Time.Round(time.Second), race.FullTime.Round(time.Second))
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// RAG defaults, overridden by -rag-chunks, -rag-k and -rag-embed-model
+const (
+	defaultRAGChunkSize  = 80
+	defaultRAGK          = 3
+	defaultRAGEmbedModel = "nomic-embed-text"
+)
+
+// groundingThreshold is the share of a sentence's content words that must
+// appear in one retrieved chunk for the sentence to count as supported.
+const groundingThreshold = 0.6
+
+// ragTemplate builds the prompt from the retrieved chunks and the question
+var ragTemplate = template.Must(template.New("rag").Parse(`Answer the question using only the context below. After each sentence, cite the chunks it relies on by their ID in square brackets, for example [{{(index .Chunks 0).ID}}]. If the context does not contain the answer, say that you don't know.
+
+Context:
+{{range .Chunks}}[{{.ID}}] {{.Text}}
+{{end}}
+Question: {{.Question}}`))
+
+// RAGOptions selects the embedding model and the chunk size and k values
+// swept for prompts backed by documents. ChunkSize and K hold the cell of
+// the sweep being run.
+type RAGOptions struct {
+	EmbedModel string
+	ChunkSizes []int
+	Ks         []int
+
+	ChunkSize int
+	K         int
+}
+
+// RAGChunk is a passage of a document, identified as file#n
+type RAGChunk struct {
+	ID     string
+	Text   string
+	Vector []float64
+}
+
+// RAGResult records the retrieval cell of a run and how well the answer is
+// grounded in the retrieved passages.
+type RAGResult struct {
+	EmbedModel string   `json:"embedModel"`
+	ChunkSize  int      `json:"chunkSize"`
+	K          int      `json:"k"`
+	Retrieved  []string `json:"retrieved"`
+
+	Sentences   int      `json:"sentences"`
+	Supported   int      `json:"supported"`
+	Grounding   float64  `json:"grounding"`
+	Unsupported []string `json:"unsupported,omitempty"`
+
+	Citations        []string `json:"citations,omitempty"`
+	ValidCitations   int      `json:"validCitations"`
+	CitationAccuracy float64  `json:"citationAccuracy"`
+}
+
+// ragIndexes caches the embedded chunks per model, chunk size and document
+// set, so every config and k of a sweep reuses the same index.
+var ragIndexes = make(map[string][]RAGChunk)
+
+// ParseIntList parses a comma-separated list of positive integers
+func ParseIntList(input string) ([]int, error) {
+	var values []int
+	for _, item := range strings.Split(input, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, err := strconv.Atoi(item)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid positive integer: %s", item)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// ChunkDocument splits a document into chunks of about size words, cut on
+// sentence boundaries. Headings are kept with the text that follows them.
+func ChunkDocument(name, text string, size int) []RAGChunk {
+	var chunks []RAGChunk
+	var current []string
+	words := 0
+
+	flush := func() {
+		if words == 0 {
+			return
+		}
+		chunks = append(chunks, RAGChunk{
+			ID:   fmt.Sprintf("%s#%d", name, len(chunks)+1),
+			Text: strings.Join(current, " "),
+		})
+		current, words = nil, 0
+	}
+
+	for _, paragraph := range strings.Split(text, "\n\n") {
+		for _, sentence := range splitSentences(paragraph) {
+			n := len(strings.Fields(sentence))
+			if words > 0 && words+n > size {
+				flush()
+			}
+			current = append(current, sentence)
+			words += n
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// ragIndex chunks and embeds the documents, or returns the cached index
+func ragIndex(url, model string, documents []string, size int) ([]RAGChunk, error) {
+	key := fmt.Sprintf("%s|%d|%s", model, size, strings.Join(documents, ","))
+	if chunks, ok := ragIndexes[key]; ok {
+		return chunks, nil
+	}
+
+	var chunks []RAGChunk
+	for _, path := range documents {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read document: %v", err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		chunks = append(chunks, ChunkDocument(name, string(data), size)...)
+	}
+
+	for i := 0; i < len(chunks); i += embedBatchSize {
+		batch := chunks[i:min(i+embedBatchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for j, chunk := range batch {
+			texts[j] = chunk.Text
+		}
+		answer, err := Embed(url, EmbedRequest{Model: model, Input: texts})
+		if err != nil {
+			return nil, fmt.Errorf("embedding error: %v", err)
+		}
+		for j := range batch {
+			batch[j].Vector = answer.Embeddings[j]
+		}
+	}
+
+	ragIndexes[key] = chunks
+	return chunks, nil
+}
+
+// RetrievePrompt embeds the question, retrieves the top k chunks of the
+// documents and builds the prompt from the RAG template.
+func RetrievePrompt(url, model, question string, documents []string, size, k int) (string, []RAGChunk, *RAGResult, error) {
+	chunks, err := ragIndex(url, model, documents, size)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if len(chunks) == 0 {
+		return "", nil, nil, fmt.Errorf("documents are empty")
+	}
+
+	answer, err := Embed(url, EmbedRequest{Model: model, Input: []string{question}})
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("embedding error: %v", err)
+	}
+	vectors := make([][]float64, len(chunks))
+	for i, chunk := range chunks {
+		vectors[i] = chunk.Vector
+	}
+
+	result := &RAGResult{EmbedModel: model, ChunkSize: size, K: k}
+	var retrieved []RAGChunk
+	for _, index := range rankDocuments(answer.Embeddings[0], vectors)[:min(k, len(chunks))] {
+		retrieved = append(retrieved, chunks[index])
+		result.Retrieved = append(result.Retrieved, chunks[index].ID)
+	}
+
+	var prompt strings.Builder
+	err = ragTemplate.Execute(&prompt, struct {
+		Chunks   []RAGChunk
+		Question string
+	}{retrieved, question})
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to build prompt: %v", err)
+	}
+
+	return prompt.String(), chunks, result, nil
+}
+
+// citation matches bracketed chunk IDs such as [handbook#3] or
+// [handbook#3, thermostat#1], leaving markdown links alone
+var citation = regexp.MustCompile(`\s*\[([^\s\[\],]+#\d+(?:\s*,\s*[^\s\[\],]+#\d+)*)\]`)
+
+// GradeGrounding checks that every answer sentence is supported by one of
+// the retrieved chunks and that citations point to chunks that were
+// retrieved into the prompt.
+func GradeGrounding(result *RAGResult, response string, chunks []RAGChunk) {
+	known := make(map[string]RAGChunk, len(chunks))
+	for _, chunk := range chunks {
+		known[chunk.ID] = chunk
+	}
+
+	var sources []map[string]bool
+	retrieved := make(map[string]bool, len(result.Retrieved))
+	for _, id := range result.Retrieved {
+		sources = append(sources, wordSet(known[id].Text))
+		retrieved[id] = true
+	}
+
+	for _, match := range citation.FindAllStringSubmatch(response, -1) {
+		for _, id := range strings.Split(match[1], ",") {
+			id = strings.TrimSpace(id)
+			result.Citations = append(result.Citations, id)
+			if retrieved[id] {
+				result.ValidCitations++
+			}
+		}
+	}
+	if len(result.Citations) > 0 {
+		result.CitationAccuracy = float64(result.ValidCitations) / float64(len(result.Citations))
+	}
+
+	for _, sentence := range splitSentences(citation.ReplaceAllString(response, "")) {
+		words := contentWords(sentence)
+		if len(words) == 0 {
+			continue
+		}
+		result.Sentences++
+
+		supported := false
+		for _, source := range sources {
+			found := 0
+			for _, word := range words {
+				if source[word] {
+					found++
+				}
+			}
+			if float64(found)/float64(len(words)) >= groundingThreshold {
+				supported = true
+				break
+			}
+		}
+		if supported {
+			result.Supported++
+		} else {
+			result.Unsupported = append(result.Unsupported, sentence)
+		}
+	}
+	if result.Sentences > 0 {
+		result.Grounding = float64(result.Supported) / float64(result.Sentences)
+	}
+}
+
+// stopWords are ignored when matching answer sentences against passages
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "are": true, "was": true, "but": true,
+	"not": true, "you": true, "your": true, "can": true, "with": true, "that": true,
+	"this": true, "they": true, "their": true, "from": true, "has": true, "have": true,
+	"its": true, "it's": true, "will": true, "which": true, "there": true, "than": true,
+	"also": true, "does": true, "what": true, "when": true, "how": true, "all": true,
+	"any": true, "per": true, "each": true, "into": true, "only": true, "should": true,
+	"according": true, "context": true, "based": true, "means": true,
+}
+
+// contentWords returns the lowercase words of text, without stop words and
+// words shorter than three characters unless they contain a digit.
+func contentWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '\''
+	}) {
+		word = strings.Trim(word, "-'")
+		hasDigit := strings.IndexFunc(word, unicode.IsDigit) >= 0
+		if stopWords[word] || (len([]rune(word)) < 3 && !hasDigit) || word == "" {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+func wordSet(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range contentWords(text) {
+		set[word] = true
+	}
+	return set
+}
+
+func printRAGSummary(results []TestResult) {
+	type totals struct {
+		runs, graded, correct, cited int
+		grounding, citations         float64
+	}
+	groups := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.RAG == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s chunk=%d k=%d", result.Config, result.RAG.ChunkSize, result.RAG.K)
+		t, ok := groups[key]
+		if !ok {
+			t = &totals{}
+			groups[key] = t
+		}
+		t.runs++
+		if result.Grade != nil {
+			t.graded++
+			if result.Grade.Passed {
+				t.correct++
+			}
+		}
+		t.grounding += result.RAG.Grounding
+		if len(result.RAG.Citations) > 0 {
+			t.cited++
+			t.citations += result.RAG.CitationAccuracy
+		}
+	}
+
+	if len(groups) == 0 {
+		return
+	}
+
+	fmt.Printf("\nRAG summary:\n")
+	fmt.Printf("%-36s %6s %8s %10s %10s\n", "Config/Cell", "Runs", "Correct", "Grounding", "Citations")
+	for _, key := range sortedKeys(groups) {
+		t := groups[key]
+		correct, citations := "-", "-"
+		if t.graded > 0 {
+			correct = fmt.Sprintf("%d/%d", t.correct, t.graded)
+		}
+		if t.cited > 0 {
+			citations = fmt.Sprintf("%.0f%%", 100*t.citations/float64(t.cited))
+		}
+		fmt.Printf("%-36s %6d %8s %9.0f%% %10s\n", key, t.runs, correct, 100*t.grounding/float64(t.runs), citations)
+	}
+}
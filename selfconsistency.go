@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parakeet-nest/parakeet/enums/option"
+)
+
+// Vote methods pick one answer out of the trials of a cell
+const (
+	VoteMajority = "majority"
+	VoteJudge    = "judge"
+)
+
+// AnswerExtractor is implemented by graders that can read the final answer
+// out of a response, so samples giving the same answer in different words
+// vote together. Correct grades an extracted answer against the expected
+// one.
+type AnswerExtractor interface {
+	Extract(response string) string
+	Correct(answer string) bool
+}
+
+// VoteResult compares the samples of one cell with the answer picked by
+// voting. SingleAccuracy is the share of samples whose answer is correct;
+// Passed grades the voted answer the same way. Samples of graders that
+// cannot extract an answer are graded on their whole response.
+type VoteResult struct {
+	Cell           string         `json:"cell"`
+	Config         ConfigKey      `json:"config"`
+	Prompt         PromptKey      `json:"prompt"`
+	Method         string         `json:"method"`
+	Samples        int            `json:"samples"`
+	Answers        map[string]int `json:"answers"`
+	Answer         string         `json:"answer"`
+	Trial          int            `json:"trial"`
+	Agreement      float64        `json:"agreement"`
+	SingleAccuracy float64        `json:"singleAccuracy"`
+	Passed         bool           `json:"passed"`
+	SampleTime     time.Duration  `json:"sampleTime"`
+	TotalTime      time.Duration  `json:"totalTime"`
+	JudgeTime      time.Duration  `json:"judgeTime,omitempty"`
+}
+
+// ParseVoteMethod validates the -vote flag; empty disables voting
+func ParseVoteMethod(input string) (string, error) {
+	switch input {
+	case "", VoteMajority, VoteJudge:
+		return input, nil
+	}
+	return "", fmt.Errorf("invalid vote method: %s (expected %s or %s)", input, VoteMajority, VoteJudge)
+}
+
+// resultGrader returns the grader of a result's prompt or instance
+func resultGrader(result TestResult) Grader {
+	if result.Instance != nil {
+		return result.Instance.Grader
+	}
+	return PromptSpecs[result.Prompt].Grader
+}
+
+// extractAnswer reads the final answer of a result with its prompt's
+// grader, falling back to the normalized response text.
+func extractAnswer(result TestResult) string {
+	if extractor, ok := resultGrader(result).(AnswerExtractor); ok {
+		return extractor.Extract(result.Response)
+	}
+	return strings.Join(Words(strings.ToLower(result.Response)), " ")
+}
+
+// answerCorrect grades the answer extracted from a sample. Without an
+// extractor the answer is the whole response, so its grade stands.
+func answerCorrect(sample TestResult, answer string) bool {
+	if extractor, ok := resultGrader(sample).(AnswerExtractor); ok {
+		return answer != "" && extractor.Correct(answer)
+	}
+	return sample.Grade.Passed
+}
+
+// Vote runs self-consistency over every graded cell with more than one
+// sample: majority voting on the extracted answers, or a judge model
+// picking the best sample (falling back to the majority on failure).
+func Vote(opts RunOptions, method, judgeModel string, results []TestResult) []VoteResult {
+	var votes []VoteResult
+	keys, cells := groupCells(results)
+	for _, key := range keys {
+		samples := cells[key]
+		if len(samples) < 2 || samples[0].Grade == nil {
+			continue
+		}
+
+		v := VoteResult{
+			Cell:    key,
+			Config:  samples[0].Config,
+			Prompt:  samples[0].Prompt,
+			Method:  VoteMajority,
+			Samples: len(samples),
+			Answers: make(map[string]int),
+		}
+
+		answers := make([]string, len(samples))
+		passed := 0
+		for i, sample := range samples {
+			answers[i] = extractAnswer(sample)
+			v.Answers[answers[i]]++
+			if answerCorrect(sample, answers[i]) {
+				passed++
+			}
+			v.TotalTime += sample.Metrics.ResponseTime
+		}
+		v.SingleAccuracy = float64(passed) / float64(len(samples))
+		v.SampleTime = v.TotalTime / time.Duration(len(samples))
+
+		chosen := majority(answers)
+		if method == VoteJudge {
+			start := time.Now()
+			pick, err := judge(opts, judgeModel, samples)
+			v.JudgeTime = time.Since(start)
+			v.TotalTime += v.JudgeTime
+			if err != nil {
+				fmt.Printf("Judge error for %s, using the majority: %v\n", key, err)
+			} else {
+				chosen = pick
+				v.Method = VoteJudge
+			}
+		}
+
+		v.Answer = answers[chosen]
+		v.Trial = samples[chosen].Trial
+		v.Agreement = float64(v.Answers[v.Answer]) / float64(len(samples))
+		v.Passed = answerCorrect(samples[chosen], v.Answer)
+
+		votes = append(votes, v)
+	}
+	return votes
+}
+
+// majority returns the index of the first sample giving the most frequent
+// non-empty answer; ties go to the answer seen first.
+func majority(answers []string) int {
+	counts := make(map[string]int)
+	best := 0
+	for i, answer := range answers {
+		if answer == "" {
+			continue
+		}
+		counts[answer]++
+		if counts[answer] > counts[answers[best]] || answers[best] == "" {
+			best = i
+		}
+	}
+	for i, answer := range answers {
+		if answer == answers[best] {
+			return i
+		}
+	}
+	return best
+}
+
+const judgePrompt = `You are given a question and %d candidate answers. Pick the best one: the most correct first, then the clearest.
+
+Question:
+%s
+
+%s
+Reply with the number of the best candidate only.`
+
+var judgeChoice = regexp.MustCompile(`\d+`)
+
+// judge asks a model to pick the best of the samples of a cell and returns
+// its index.
+func judge(opts RunOptions, model string, samples []TestResult) (int, error) {
+	question := TestPrompts[samples[0].Prompt]
+	if samples[0].Instance != nil {
+		question = samples[0].Instance.Text
+	}
+
+	var candidates strings.Builder
+	for i, sample := range samples {
+		fmt.Fprintf(&candidates, "Candidate %d:\n%s\n\n", i+1, strings.TrimSpace(sample.Response))
+	}
+
+	answer, err := Generate(opts.URL, GenerateRequest{
+		Model:   model,
+		Prompt:  fmt.Sprintf(judgePrompt, len(samples), question, candidates.String()),
+		Options: OllamaOptions(map[string]interface{}{option.Temperature: 0.0}),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	match := judgeChoice.FindString(answer.Response)
+	n, err := strconv.Atoi(match)
+	if err != nil || n < 1 || n > len(samples) {
+		return 0, fmt.Errorf("no candidate number in %q", strings.TrimSpace(answer.Response))
+	}
+	return n - 1, nil
+}
+
+// printVoteSummary compares single-sample and voted accuracy per config,
+// with the latency of one sample against all K (plus the judge).
+func printVoteSummary(votes []VoteResult) {
+	if len(votes) == 0 {
+		return
+	}
+
+	type totals struct {
+		cells, voted          int
+		single, agreement     float64
+		sampleTime, totalTime time.Duration
+	}
+	byConfig := make(map[string]*totals)
+	for _, v := range votes {
+		config := string(v.Config)
+		t, ok := byConfig[config]
+		if !ok {
+			t = &totals{}
+			byConfig[config] = t
+		}
+		t.cells++
+		t.single += v.SingleAccuracy
+		t.agreement += v.Agreement
+		if v.Passed {
+			t.voted++
+		}
+		t.sampleTime += v.SampleTime
+		t.totalTime += v.TotalTime
+	}
+
+	fmt.Printf("\nSelf-consistency summary (%s, %d samples per cell):\n", votes[0].Method, votes[0].Samples)
+	fmt.Printf("%-20s %6s %10s %10s %10s %12s %12s %8s\n", "Config", "Cells", "Single", "Voted", "Agreement", "1 sample", "All samples", "Cost")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		cells := float64(t.cells)
+		sample := t.sampleTime / time.Duration(t.cells)
+		total := t.totalTime / time.Duration(t.cells)
+		cost := "-"
+		if sample > 0 {
+			cost = fmt.Sprintf("%.1fx", float64(total)/float64(sample))
+		}
+		fmt.Printf("%-20s %6d %9.0f%% %9.0f%% %9.0f%% %12v %12v %8s\n", config, t.cells,
+			100*t.single/cells, 100*float64(t.voted)/cells, 100*t.agreement/cells,
+			sample.Round(time.Millisecond), total.Round(time.Millisecond), cost)
+	}
+}
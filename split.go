@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"time"
+)
+
+// Split names for prompt assignments
+const (
+	SplitDev  = "dev"
+	SplitTest = "test"
+)
+
+// Split assigns the prompts of a suite to a dev and a test split, so the
+// tuning commands never see the prompts their configs are reported on.
+// Prompts are hashed with the seed: either TestFraction of them go to
+// test, or they fall in Folds folds and fold Fold (from 1) is the test
+// split. Assign fixes the split of some prompts over the hash.
+type Split struct {
+	Seed         int64                `json:"seed"`
+	TestFraction float64              `json:"testFraction,omitempty"`
+	Folds        int                  `json:"folds,omitempty"`
+	Fold         int                  `json:"fold,omitempty"`
+	Assign       map[PromptKey]string `json:"assign,omitempty"`
+}
+
+// Validate checks that the split is either a fraction or k-fold, and that
+// assignments name known prompts and splits
+func (s *Split) Validate() error {
+	switch {
+	case s.TestFraction == 0 && s.Folds == 0 && len(s.Assign) == 0:
+		return fmt.Errorf("split needs testFraction, folds or assign")
+	case s.TestFraction != 0 && s.Folds != 0:
+		return fmt.Errorf("split has both testFraction and folds")
+	case s.TestFraction < 0 || s.TestFraction >= 1:
+		return fmt.Errorf("split testFraction %g out of range [0, 1)", s.TestFraction)
+	case s.Folds == 1 || s.Folds < 0:
+		return fmt.Errorf("split needs at least 2 folds, got %d", s.Folds)
+	case s.Folds > 0 && (s.Fold < 1 || s.Fold > s.Folds):
+		return fmt.Errorf("split fold %d out of range [1, %d]", s.Fold, s.Folds)
+	}
+	for _, prompt := range sortedKeys(s.Assign) {
+		if _, ok := TestPrompts[prompt]; !ok {
+			return fmt.Errorf("split assigns unknown prompt %s", prompt)
+		}
+		if split := s.Assign[prompt]; split != SplitDev && split != SplitTest {
+			return fmt.Errorf("split assigns %s to %q: expected %s or %s", prompt, split, SplitDev, SplitTest)
+		}
+	}
+	return nil
+}
+
+// IsTest reports whether a prompt is in the test split
+func (s *Split) IsTest(prompt PromptKey) bool {
+	if split, ok := s.Assign[prompt]; ok {
+		return split == SplitTest
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(strconv.FormatInt(s.Seed, 10) + ":" + string(prompt)))
+	sum := h.Sum64()
+	if s.Folds > 0 {
+		return int(sum%uint64(s.Folds)) == s.Fold-1
+	}
+	return float64(sum>>11)/(1<<53) < s.TestFraction
+}
+
+// Partition splits prompts into dev and test, keeping their order
+func (s *Split) Partition(prompts []PromptKey) (dev, test []PromptKey) {
+	for _, prompt := range prompts {
+		if s.IsTest(prompt) {
+			test = append(test, prompt)
+		} else {
+			dev = append(dev, prompt)
+		}
+	}
+	return dev, test
+}
+
+func (s *Split) String() string {
+	switch {
+	case s.Folds > 0:
+		return fmt.Sprintf("fold %d of %d, seed %d", s.Fold, s.Folds, s.Seed)
+	case s.TestFraction > 0:
+		return fmt.Sprintf("%.0f%% test, seed %d", 100*s.TestFraction, s.Seed)
+	}
+	return "assigned"
+}
+
+// HoldoutResult compares the score a config reached on the dev prompts it
+// was tuned on with its score on the test prompts. Gap is dev minus test,
+// so a positive gap means the dev score was optimistic.
+type HoldoutResult struct {
+	Config    ConfigKey `json:"config"`
+	DevScore  float64   `json:"devScore"`
+	DevRuns   int       `json:"devRuns"`
+	TestScore float64   `json:"testScore"`
+	TestRuns  int       `json:"testRuns"`
+	Gap       float64   `json:"gap"`
+}
+
+// Holdout is what a tuning run hands to the final evaluation: the prompts
+// of both splits and the configs it picked, with their dev scores
+type Holdout struct {
+	Dev, Test  []PromptKey
+	Candidates []HoldoutResult
+}
+
+// HoldoutReport is the final evaluation of tuned configs on the test split
+type HoldoutReport struct {
+	Split     string          `json:"split"`
+	Dev       []PromptKey     `json:"dev"`
+	Test      []PromptKey     `json:"test"`
+	Results   []HoldoutResult `json:"results"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// RunHoldout runs the candidates of a holdout on its graded test prompts
+func RunHoldout(opts RunOptions, split *Split, holdout Holdout) (*HoldoutReport, error) {
+	test := gradedPrompts(holdout.Test)
+	if len(test) == 0 {
+		return nil, fmt.Errorf("none of the test prompts are graded")
+	}
+
+	configs := make([]ConfigKey, len(holdout.Candidates))
+	for i, c := range holdout.Candidates {
+		configs[i] = c.Config
+	}
+	fmt.Printf("\nHoldout: %d configs on %d test prompts\n", len(configs), len(test))
+	results, err := RunTestPattern(opts, CustomTest(test, configs))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HoldoutReport{Split: split.String(), Dev: gradedPrompts(holdout.Dev), Test: test, Timestamp: time.Now()}
+	for _, c := range holdout.Candidates {
+		var score float64
+		for _, result := range results {
+			if result.Config == c.Config && result.Grade != nil {
+				c.TestRuns++
+				score += result.Grade.Score
+			}
+		}
+		if c.TestRuns > 0 {
+			c.TestScore = score / float64(c.TestRuns)
+			c.Gap = c.DevScore - c.TestScore
+		}
+		report.Results = append(report.Results, c)
+	}
+	return report, nil
+}
+
+// printHoldoutReport prints the dev and test scores of the tuned configs
+// with the gap between them
+func printHoldoutReport(report *HoldoutReport) {
+	fmt.Printf("\nHoldout report (%s; %d dev, %d test prompts):\n", report.Split, len(report.Dev), len(report.Test))
+	fmt.Printf("%-28s %10s %10s %8s\n", "Config", "Dev", "Test", "Gap")
+	for _, r := range report.Results {
+		test, gap := "-", "-"
+		if r.TestRuns > 0 {
+			test, gap = fmt.Sprintf("%.3f", r.TestScore), fmt.Sprintf("%+.3f", r.Gap)
+		}
+		fmt.Printf("%-28s %10.3f %10s %8s\n", r.Config, r.DevScore, test, gap)
+	}
+}
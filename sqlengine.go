@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlengine.go runs the SQL grader's fixtures on SQLite, through the pure-Go
+// modernc.org/sqlite driver (no cgo). Every query gets a fresh in-memory
+// database loaded from the fixture, so a query cannot affect the next one.
+
+// sqlQueryTimeout bounds a query, e.g. a recursive CTE that never ends
+const sqlQueryTimeout = 5 * time.Second
+
+// SQLSyntaxError reports a statement SQLite could not parse
+type SQLSyntaxError struct {
+	Message string
+}
+
+func (e *SQLSyntaxError) Error() string {
+	return "syntax error: " + e.Message
+}
+
+// SQLTable is a fixture table. Columns whose values are all integral
+// numbers are created as INTEGER, other numeric columns as REAL and the
+// rest as TEXT.
+type SQLTable struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// SQLDatabase maps lower-case table names to tables
+type SQLDatabase map[string]*SQLTable
+
+// SQLRows is the result of a query. Ordered is set when the query has an
+// ORDER BY, so the order of its rows is meaningful.
+type SQLRows struct {
+	Columns []string
+	Rows    [][]interface{}
+	Ordered bool
+}
+
+var (
+	orderByClause = regexp.MustCompile(`(?i)\bORDER\s+BY\b`)
+	syntaxErrors  = regexp.MustCompile(`(?i)syntax error|incomplete input|unrecognized token`)
+)
+
+// Query loads the fixture into a fresh in-memory SQLite database and runs a
+// single statement on it
+func (db SQLDatabase) Query(query string) (*SQLRows, error) {
+	conn, err := db.open()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sqlQueryTimeout)
+	defer cancel()
+
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		if syntaxErrors.MatchString(err.Error()) {
+			return nil, &SQLSyntaxError{Message: err.Error()}
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &SQLRows{Columns: columns, Ordered: orderByClause.MatchString(query)}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// open creates an in-memory database holding the fixture tables. The pool
+// is limited to one connection, since each SQLite connection to :memory:
+// is a separate database.
+func (db SQLDatabase) open() (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open fixture: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+
+	for _, name := range sortedKeys(db) {
+		table := db[name]
+		columns := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = fmt.Sprintf("%q %s", column, columnType(table.Rows, i))
+		}
+		if _, err := conn.Exec(fmt.Sprintf("CREATE TABLE %q (%s)", name, strings.Join(columns, ", "))); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create fixture table %s: %v", name, err)
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+		insert := fmt.Sprintf("INSERT INTO %q VALUES (%s)", name, placeholders)
+		for _, row := range table.Rows {
+			if _, err := conn.Exec(insert, row...); err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to load fixture table %s: %v", name, err)
+			}
+		}
+	}
+	return conn, nil
+}
+
+// columnType picks the SQLite type of a fixture column from its values
+func columnType(rows [][]interface{}, column int) string {
+	kind := "INTEGER"
+	for _, row := range rows {
+		switch v := row[column].(type) {
+		case nil:
+		case int, int64:
+		case float64:
+			if v != math.Trunc(v) {
+				kind = "REAL"
+			}
+		default:
+			return "TEXT"
+		}
+	}
+	return kind
+}
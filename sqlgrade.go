@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SQL grader verdicts
+const (
+	VerdictNoSQL          = "no_sql"
+	VerdictSyntaxError    = "syntax_error"
+	VerdictExecutionError = "execution_error"
+	VerdictWrongRows      = "wrong_rows"
+	VerdictWrongOrder     = "wrong_order"
+	VerdictCorrect        = "correct"
+)
+
+// EmployeesFixture builds the database described by the `conversion` prompt.
+// Marketing has salaries on both sides of the $60,000 boundary, including
+// one exactly at it, and distinct hire dates so the expected order is unique.
+func EmployeesFixture() SQLDatabase {
+	return SQLDatabase{
+		"employees": {
+			Columns: []string{"employee_id", "name", "department", "salary", "hire_date"},
+			Rows: [][]interface{}{
+				{1.0, "Alice Martin", "Marketing", 72000.0, "2019-03-15"},
+				{2.0, "Bruno Silva", "Marketing", 58000.0, "2021-07-01"},
+				{3.0, "Chen Wei", "Engineering", 95000.0, "2018-11-20"},
+				{4.0, "Dana Brooks", "Marketing", 60000.0, "2022-01-10"},
+				{5.0, "Elif Kaya", "Marketing", 81000.0, "2023-05-02"},
+				{6.0, "Farid Haddad", "Sales", 64000.0, "2020-09-14"},
+				{7.0, "Grace Okafor", "Marketing", 66500.0, "2020-02-28"},
+				{8.0, "Hiro Tanaka", "Engineering", 61000.0, "2024-04-08"},
+				{9.0, "Ines Duarte", "Finance", 70000.0, "2017-06-30"},
+				{10.0, "Jonas Berg", "Marketing", 90000.0, "2016-10-03"},
+			},
+		},
+		"departments": {
+			Columns: []string{"department_id", "department_name", "location"},
+			Rows: [][]interface{}{
+				{1.0, "Marketing", "New York"},
+				{2.0, "Engineering", "San Francisco"},
+				{3.0, "Sales", "Chicago"},
+				{4.0, "Finance", "Boston"},
+			},
+		},
+	}
+}
+
+// SQLGrader runs the SQL found in a response against a fixture database and
+// compares its rows with those of a reference query.
+type SQLGrader struct {
+	Fixture   func() SQLDatabase
+	Reference string
+}
+
+func (g SQLGrader) Name() string { return "sql" }
+
+var (
+	fencedSQL   = regexp.MustCompile("(?is)```(?:sql|sqlite|postgresql|mysql)?\\s*\\n(.*?)```")
+	selectQuery = regexp.MustCompile(`(?is)\bSELECT\b.*?(?:;|$)`)
+	selectProse = regexp.MustCompile(`(?is)\bSELECT\b.*?(?:;|\n\s*\n|$)`)
+	// proseLine starts with a capitalized word, as in "This query joins",
+	// where SQL lines start with keywords in upper or lower case
+	proseLine = regexp.MustCompile(`^\s*[A-Z][a-z]+\b`)
+)
+
+// ExtractSQL returns the first SQL statement of a response, preferring a
+// fenced code block. Outside a fence, the statement ends at a semicolon, a
+// blank line or a line of prose, so the explanation after it is left out.
+func ExtractSQL(response string) string {
+	if match := fencedSQL.FindStringSubmatch(response); match != nil {
+		return strings.TrimSpace(selectQuery.FindString(match[1]))
+	}
+	query := selectProse.FindString(response)
+	lines := strings.Split(query, "\n")
+	for i, line := range lines[1:] {
+		if proseLine.MatchString(line) {
+			query = strings.Join(lines[:i+1], "\n")
+			break
+		}
+	}
+	return strings.TrimSpace(query)
+}
+
+func (g SQLGrader) Grade(response string) *Grade {
+	grade := &Grade{Grader: g.Name()}
+
+	query := ExtractSQL(response)
+	if query == "" {
+		grade.Verdict = VerdictNoSQL
+		grade.Details = "no SELECT statement found in the response"
+		return grade
+	}
+
+	db := g.Fixture()
+	want, err := db.Query(g.Reference)
+	if err != nil {
+		grade.Verdict = VerdictExecutionError
+		grade.Details = "reference query failed: " + err.Error()
+		return grade
+	}
+
+	got, err := db.Query(query)
+	if err != nil {
+		if _, ok := err.(*SQLSyntaxError); ok {
+			grade.Verdict = VerdictSyntaxError
+		} else {
+			grade.Verdict = VerdictExecutionError
+		}
+		grade.Details = err.Error()
+		return grade
+	}
+
+	wantRows, gotRows, note := alignColumns(want, got)
+	switch {
+	case !sameRowSet(wantRows, gotRows):
+		grade.Verdict = VerdictWrongRows
+		grade.Details = fmt.Sprintf("expected %d rows, got %d", len(wantRows), len(gotRows))
+	case want.Ordered && !sameRowOrder(wantRows, gotRows):
+		grade.Verdict = VerdictWrongOrder
+		grade.Score = 0.5
+		grade.Details = "rows match but are in the wrong order"
+	default:
+		grade.Verdict = VerdictCorrect
+		grade.Score = 1
+		grade.Passed = true
+	}
+	if note != "" {
+		grade.Details = strings.TrimPrefix(grade.Details+"; "+note, "; ")
+	}
+
+	return grade
+}
+
+// alignColumns projects both results onto the reference columns the
+// candidate also returns, so `SELECT *` and a narrower column list can be
+// compared. When no column names are shared it falls back to positions.
+func alignColumns(want, got *SQLRows) ([][]interface{}, [][]interface{}, string) {
+	var wantIdx, gotIdx []int
+	for i, column := range want.Columns {
+		for j, candidate := range got.Columns {
+			if strings.EqualFold(column, candidate) {
+				wantIdx = append(wantIdx, i)
+				gotIdx = append(gotIdx, j)
+				break
+			}
+		}
+	}
+
+	note := ""
+	if len(wantIdx) == 0 {
+		return want.Rows, got.Rows, "no shared column names, compared by position"
+	}
+	if len(wantIdx) < len(want.Columns) {
+		note = fmt.Sprintf("compared on %d of %d reference columns", len(wantIdx), len(want.Columns))
+	}
+
+	project := func(rows [][]interface{}, idx []int) [][]interface{} {
+		projected := make([][]interface{}, len(rows))
+		for r, row := range rows {
+			for _, i := range idx {
+				projected[r] = append(projected[r], row[i])
+			}
+		}
+		return projected
+	}
+
+	return project(want.Rows, wantIdx), project(got.Rows, gotIdx), note
+}
+
+func rowKey(row []interface{}) string {
+	parts := make([]string, len(row))
+	for i, value := range row {
+		parts[i] = fmt.Sprint(value)
+	}
+	return strings.Join(parts, "\x1f")
+}
+
+func sameRowSet(want, got [][]interface{}) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, row := range want {
+		counts[rowKey(row)]++
+	}
+	for _, row := range got {
+		key := rowKey(row)
+		if counts[key] == 0 {
+			return false
+		}
+		counts[key]--
+	}
+	return true
+}
+
+func sameRowOrder(want, got [][]interface{}) bool {
+	for i := range want {
+		if rowKey(want[i]) != rowKey(got[i]) {
+			return false
+		}
+	}
+	return true
+}
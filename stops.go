@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Done reasons reported by Ollama, plus the one set when the client closes
+// the stream
+const (
+	DoneReasonStop      = "stop"
+	DoneReasonLength    = "length"
+	DoneReasonCancelled = "cancelled"
+)
+
+// StopSequences returns the stop sequences declared by a preset, under
+// option.Stop or "stop".
+func StopSequences(config map[string]interface{}) []string {
+	value, ok := presetValue(config, "stop")
+	if !ok {
+		return nil
+	}
+	spec, _ := LookupOption("stop")
+	sequences, err := spec.Coerce(value)
+	if err != nil {
+		return nil
+	}
+	return sequences.([]string)
+}
+
+// StopResult checks a response against the stop sequences of the preset.
+// EndedOnStop is set when the done reason is "stop", which Ollama reports
+// both for the model's end token and for a stop sequence, so it does not
+// prove a sequence was hit. Ollama strips the sequence it stops on, so a
+// sequence found in the response (Leaked) means the server generated past
+// it.
+type StopResult struct {
+	Sequences   []string `json:"sequences"`
+	EndedOnStop bool     `json:"endedOnStop"`
+	Leaked      []string `json:"leaked,omitempty"`
+}
+
+// CheckStop checks a response against stop sequences, or returns nil when
+// there are none.
+func CheckStop(sequences []string, response, doneReason string) *StopResult {
+	if len(sequences) == 0 {
+		return nil
+	}
+	result := &StopResult{Sequences: sequences, EndedOnStop: doneReason == DoneReasonStop}
+	for _, s := range sequences {
+		if strings.Contains(response, s) {
+			result.Leaked = append(result.Leaked, s)
+		}
+	}
+	return result
+}
+
+// printStopSummary reports per config how generations ended, with the
+// truncation rate (done reason "length": num_predict or the context ran
+// out) and how often stop sequences were honored.
+func printStopSummary(results []TestResult) {
+	type totals struct {
+		runs, stop, length, cancelled, other int
+		stopChecks, honored                  int
+	}
+	byConfig := make(map[string]*totals)
+	for _, result := range results {
+		if result.DoneReason == "" {
+			continue
+		}
+		config := string(result.Config)
+		t, ok := byConfig[config]
+		if !ok {
+			t = &totals{}
+			byConfig[config] = t
+		}
+		t.runs++
+		switch result.DoneReason {
+		case DoneReasonStop:
+			t.stop++
+		case DoneReasonLength:
+			t.length++
+		case DoneReasonCancelled:
+			t.cancelled++
+		default:
+			t.other++
+		}
+		if s := result.Stop; s != nil {
+			t.stopChecks++
+			if len(s.Leaked) == 0 {
+				t.honored++
+			}
+		}
+	}
+
+	if len(byConfig) == 0 {
+		return
+	}
+
+	fmt.Printf("\nStop reason summary:\n")
+	fmt.Printf("%-20s %6s %6s %8s %10s %6s %12s %14s\n", "Config", "Runs", "Stop", "Length", "Cancelled", "Other", "Truncated", "Stop honored")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		honored := "-"
+		if t.stopChecks > 0 {
+			honored = fmt.Sprintf("%d/%d", t.honored, t.stopChecks)
+		}
+		fmt.Printf("%-20s %6d %6d %8d %10d %6d %11.0f%% %14s\n", config, t.runs, t.stop, t.length, t.cancelled, t.other,
+			100*float64(t.length)/float64(t.runs), honored)
+	}
+}
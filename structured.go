@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SchemaMode controls how a prompt's JSON Schema reaches the model
+type SchemaMode string
+
+const (
+	// SchemaModeFormat sends the schema through Ollama's `format` parameter
+	SchemaModeFormat SchemaMode = "format"
+	// SchemaModePrompt appends the schema to the prompt text
+	SchemaModePrompt SchemaMode = "prompt"
+)
+
+// SchemaViolation is a single schema error located by a JSON pointer
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// StructuredResult holds the outcome of validating a JSON response
+type StructuredResult struct {
+	ParseOK       bool              `json:"parseOk"`
+	ParseError    string            `json:"parseError,omitempty"`
+	SchemaValid   bool              `json:"schemaValid"`
+	Violations    []SchemaViolation `json:"violations,omitempty"`
+	FieldsMatched int               `json:"fieldsMatched"`
+	FieldsTotal   int               `json:"fieldsTotal"`
+	FieldAccuracy float64           `json:"fieldAccuracy"`
+	Mismatches    []string          `json:"mismatches,omitempty"`
+}
+
+func ParseSchemaMode(input string) (SchemaMode, error) {
+	switch mode := SchemaMode(strings.TrimSpace(input)); mode {
+	case SchemaModeFormat, SchemaModePrompt:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid schema mode: %s", input)
+	}
+}
+
+// schemaPrompt appends the schema instructions used in prompt mode
+func schemaPrompt(prompt string, schema json.RawMessage) string {
+	return fmt.Sprintf("%s\n\nRespond only with a JSON value that satisfies this JSON Schema:\n%s", prompt, string(schema))
+}
+
+var fencedJSON = regexp.MustCompile("(?s)```(?:json)?\\s*(.*?)```")
+
+// extractJSON returns the JSON payload of a response, unwrapping a Markdown
+// code fence if the model added one.
+func extractJSON(response string) string {
+	if match := fencedJSON.FindStringSubmatch(response); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	return strings.TrimSpace(response)
+}
+
+// ValidateStructured parses a response, validates it against schema and
+// compares it field by field with expected (which may be nil).
+func ValidateStructured(response string, schema json.RawMessage, expected interface{}) *StructuredResult {
+	result := &StructuredResult{}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(extractJSON(response)), &value); err != nil {
+		result.ParseError = err.Error()
+		if expected != nil {
+			result.FieldsTotal = len(flattenJSON("", expected))
+		}
+		return result
+	}
+	result.ParseOK = true
+
+	if len(schema) > 0 {
+		var root map[string]interface{}
+		if err := json.Unmarshal(schema, &root); err != nil {
+			result.Violations = []SchemaViolation{{Pointer: "", Message: "invalid schema: " + err.Error()}}
+		} else {
+			result.Violations = validateSchema(root, value, "")
+		}
+	}
+	result.SchemaValid = len(result.Violations) == 0
+
+	if expected != nil {
+		want := flattenJSON("", expected)
+		got := flattenJSON("", value)
+		result.FieldsTotal = len(want)
+		for _, pointer := range sortedKeys(want) {
+			if jsonEqual(want[pointer], got[pointer]) {
+				result.FieldsMatched++
+			} else {
+				result.Mismatches = append(result.Mismatches, pointer)
+			}
+		}
+		if result.FieldsTotal > 0 {
+			result.FieldAccuracy = float64(result.FieldsMatched) / float64(result.FieldsTotal)
+		}
+	}
+
+	return result
+}
+
+// validateSchema checks value against the subset of JSON Schema used by the
+// prompt suite: type, enum, const, properties, required,
+// additionalProperties, items, min/max bounds, lengths and pattern.
+func validateSchema(schema map[string]interface{}, value interface{}, pointer string) []SchemaViolation {
+	var violations []SchemaViolation
+	fail := func(format string, args ...interface{}) {
+		violations = append(violations, SchemaViolation{Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("expected type %v, got %s", t, jsonType(value))
+		return violations
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("value %v is not one of %v", value, enum)
+		}
+	}
+
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		fail("value %v does not equal %v", value, constant)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if key, ok := name.(string); ok {
+					if _, present := v[key]; !present {
+						violations = append(violations, SchemaViolation{
+							Pointer: pointer + "/" + escapePointer(key),
+							Message: "required property is missing",
+						})
+					}
+				}
+			}
+		}
+		for _, key := range sortedKeys(v) {
+			child := pointer + "/" + escapePointer(key)
+			if sub, ok := properties[key].(map[string]interface{}); ok {
+				violations = append(violations, validateSchema(sub, v[key], child)...)
+				continue
+			}
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					violations = append(violations, SchemaViolation{Pointer: child, Message: "additional property is not allowed"})
+				}
+			case map[string]interface{}:
+				violations = append(violations, validateSchema(extra, v[key], child)...)
+			}
+		}
+
+	case []interface{}:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("expected at least %v items, got %d", n, len(v))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("expected at most %v items, got %d", n, len(v))
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				violations = append(violations, validateSchema(items, item, fmt.Sprintf("%s/%d", pointer, i))...)
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("expected at least %v characters, got %v", n, length)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("expected at most %v characters, got %v", n, length)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				fail("value %q does not match pattern %s", v, pattern)
+			}
+		}
+
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			fail("value %v is below minimum %v", v, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			fail("value %v is above maximum %v", v, n)
+		}
+	}
+
+	return violations
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func matchesType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		actual := jsonType(value)
+		return actual == t || (t == "number" && actual == "integer")
+	case []interface{}:
+		for _, candidate := range t {
+			if matchesType(candidate, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// flattenJSON maps every leaf of value to its JSON pointer
+func flattenJSON(pointer string, value interface{}) map[string]interface{} {
+	leaves := make(map[string]interface{})
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			for p, leaf := range flattenJSON(pointer+"/"+escapePointer(key), child) {
+				leaves[p] = leaf
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			for p, leaf := range flattenJSON(fmt.Sprintf("%s/%d", pointer, i), child) {
+				leaves[p] = leaf
+			}
+		}
+	default:
+		leaves[pointer] = v
+	}
+	return leaves
+}
+
+// jsonEqual compares two decoded JSON values, ignoring case and surrounding
+// whitespace in strings, at any depth.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		s, ok := b.(string)
+		return ok && strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(s))
+	case float64:
+		f, ok := b.(float64)
+		return ok && math.Abs(a-f) < 1e-9
+	case int:
+		f, ok := b.(float64)
+		return ok && float64(a) == f
+	case map[string]interface{}:
+		m, ok := b.(map[string]interface{})
+		if !ok || len(m) != len(a) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := m[key]
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		s, ok := b.([]interface{})
+		if !ok || len(s) != len(a) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], s[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// printStructuredSummary compares structured output quality across configs
+func printStructuredSummary(results []TestResult) {
+	type totals struct {
+		runs, parsed, valid int
+		accuracy            float64
+	}
+	byConfig := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.Structured == nil {
+			continue
+		}
+		t, ok := byConfig[string(result.Config)]
+		if !ok {
+			t = &totals{}
+			byConfig[string(result.Config)] = t
+		}
+		t.runs++
+		if result.Structured.ParseOK {
+			t.parsed++
+		}
+		if result.Structured.SchemaValid {
+			t.valid++
+		}
+		t.accuracy += result.Structured.FieldAccuracy
+	}
+
+	if len(byConfig) == 0 {
+		return
+	}
+
+	fmt.Printf("\nStructured output summary:\n")
+	fmt.Printf("%-20s %6s %8s %8s %10s\n", "Config", "Runs", "Parsed", "Valid", "Accuracy")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		n := float64(t.runs)
+		fmt.Printf("%-20s %6d %7.0f%% %7.0f%% %9.0f%%\n",
+			config, t.runs, 100*float64(t.parsed)/n, 100*float64(t.valid)/n, 100*t.accuracy/n)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SuitePreset is a preset declared in a suite file. Extends names a
+// built-in or suite preset whose options are copied before Options are
+// applied over them.
+type SuitePreset struct {
+	Extends string                 `json:"extends,omitempty"`
+	Options map[string]interface{} `json:"options"`
+}
+
+// Suite is a JSON file of presets added to the built-in ones, with an
+// optional split of the prompts into dev and test
+type Suite struct {
+	Configs map[string]SuitePreset `json:"configs"`
+	Split   *Split                 `json:"split,omitempty"`
+}
+
+// LoadSuite reads a suite file and adds its presets to Configs, resolving
+// extends chains. Option values are validated with the built-in presets.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %v", err)
+	}
+
+	var suite Suite
+	if err := json.Unmarshal(data, &suite); err != nil {
+		return nil, fmt.Errorf("failed to parse suite %s: %v", path, err)
+	}
+
+	if suite.Split != nil {
+		if err := suite.Split.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid suite %s: %v", path, err)
+		}
+	}
+
+	for _, name := range sortedKeys(suite.Configs) {
+		if _, exists := Configs[ConfigKey(name)]; exists {
+			return nil, fmt.Errorf("suite preset %s is already defined", name)
+		}
+	}
+
+	resolved := make(map[string]map[string]interface{})
+	var resolve func(name string, chain []string) (map[string]interface{}, error)
+	resolve = func(name string, chain []string) (map[string]interface{}, error) {
+		if config, ok := resolved[name]; ok {
+			return config, nil
+		}
+		for _, seen := range chain {
+			if seen == name {
+				return nil, fmt.Errorf("preset %s extends itself: %s", name, strings.Join(append(chain, name), " -> "))
+			}
+		}
+
+		preset, ok := suite.Configs[name]
+		if !ok {
+			if config, ok := Configs[ConfigKey(name)]; ok {
+				return config, nil
+			}
+			return nil, fmt.Errorf("preset %s extends unknown preset %s", chain[len(chain)-1], name)
+		}
+
+		config := make(map[string]interface{})
+		if preset.Extends != "" {
+			base, err := resolve(preset.Extends, append(chain, name))
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range base {
+				config[key] = value
+			}
+		}
+		for key, value := range preset.Options {
+			setOption(config, key, value)
+		}
+		resolved[name] = config
+		return config, nil
+	}
+
+	for _, name := range sortedKeys(suite.Configs) {
+		config, err := resolve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		Configs[ConfigKey(name)] = config
+	}
+
+	return &suite, nil
+}
+
+// setOption sets an option in a preset, replacing the value it may have
+// under its other name (parakeet or Ollama), so overrides do not set it
+// twice. Unknown keys are kept as they are for validation to report.
+func setOption(config map[string]interface{}, key string, value interface{}) {
+	if spec, ok := LookupOption(key); ok {
+		delete(config, spec.Name)
+		if spec.Key != "" {
+			delete(config, spec.Key)
+		}
+		key = spec.Name
+	}
+	config[key] = value
+}
+
+// SetFlag collects repeated -set key=value flags
+type SetFlag []string
+
+func (s *SetFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *SetFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// ApplyOverrides parses key=value overrides and sets them on every preset,
+// copying each preset first since suite presets may share their maps.
+func ApplyOverrides(overrides []string) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	values := make(map[string]interface{})
+	var names []string
+	for _, override := range overrides {
+		key, text, ok := strings.Cut(override, "=")
+		if !ok {
+			return fmt.Errorf("invalid override %q: expected key=value", override)
+		}
+		spec, ok := LookupOption(strings.TrimSpace(key))
+		if !ok {
+			return fmt.Errorf("invalid override %q: unknown option %s", override, key)
+		}
+		value, err := spec.ParseValue(strings.TrimSpace(text))
+		if err != nil {
+			return fmt.Errorf("invalid override %q: %v", override, err)
+		}
+		if _, ok := values[spec.Name]; !ok {
+			names = append(names, spec.Name)
+		}
+		values[spec.Name] = value
+	}
+
+	for key, config := range Configs {
+		merged := make(map[string]interface{}, len(config)+len(names))
+		for k, v := range config {
+			merged[k] = v
+		}
+		for _, name := range names {
+			setOption(merged, name, values[name])
+		}
+		Configs[key] = merged
+	}
+	return nil
+}
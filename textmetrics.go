@@ -0,0 +1,277 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Readability holds the Flesch scores of an English response. Reading ease
+// runs from about 0 (academic) to 100 (easy); 60-70 suits a 13-15 year old.
+type Readability struct {
+	FleschReadingEase  float64 `json:"fleschReadingEase"`
+	FleschKincaidGrade float64 `json:"fleschKincaidGrade"`
+	Syllables          int     `json:"syllables"`
+}
+
+// MeasureResponse computes the text metrics of a response and the token
+// counts reported by the server. evalDuration is in nanoseconds.
+func MeasureResponse(text string, responseTime time.Duration, promptTokens, responseTokens int, evalDuration int64) ResponseMetrics {
+	metrics := ResponseMetrics{
+		ResponseTime:   responseTime,
+		CharCount:      utf8.RuneCountInString(text),
+		ByteCount:      len(text),
+		GraphemeCount:  CountGraphemes(text),
+		WordCount:      len(Words(text)),
+		SentenceCount:  len(splitSentences(text)),
+		ParagraphCount: len(Paragraphs(text)),
+		PromptTokens:   promptTokens,
+		ResponseTokens: responseTokens,
+	}
+	if evalDuration > 0 {
+		metrics.TokensPerSecond = float64(responseTokens) / time.Duration(evalDuration).Seconds()
+	}
+	if AnalyzeLanguage(text).Main() == "en" {
+		metrics.Readability = Flesch(text)
+	}
+	return metrics
+}
+
+// extendsGrapheme reports whether r continues the grapheme cluster of the
+// rune before it: combining marks, variation selectors, emoji skin tones
+// and tags, and Hangul vowel and final jamo.
+func extendsGrapheme(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case r >= 0xFE00 && r <= 0xFE0F, r >= 0xE0100 && r <= 0xE01EF:
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF:
+		return true
+	case r >= 0xE0020 && r <= 0xE007F:
+		return true
+	case r >= 0x1160 && r <= 0x11FF:
+		return true
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
+
+// CountGraphemes counts user-perceived characters, approximating the
+// extended grapheme clusters of UAX #29: "é" written with a combining
+// accent, a flag and a family emoji joined by ZWJ each count once.
+func CountGraphemes(text string) int {
+	n := 0
+	var prev rune
+	joined, pairedFlag := false, false
+	for i, r := range text {
+		switch {
+		case i == 0:
+			n++
+		case prev == '\r' && r == '\n':
+		case extendsGrapheme(r), r == '‍':
+		case joined:
+		case isRegionalIndicator(r) && isRegionalIndicator(prev) && !pairedFlag:
+			pairedFlag = true
+			prev = r
+			continue
+		default:
+			n++
+		}
+		joined = r == '‍'
+		pairedFlag = false
+		prev = r
+	}
+	return n
+}
+
+// Words splits text into words. Letters and digits form words, joined by
+// inner apostrophes and hyphens. Chinese and Japanese are written without
+// spaces and are segmented by rules rather than a dictionary (see
+// segmentCJK), and a Katakana run is one loanword.
+func Words(text string) []string {
+	var words []string
+	runes := []rune(text)
+	japanese := strings.ContainsFunc(text, func(r rune) bool { return scriptOf(r) == "Hiragana" })
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			words = append(words, string(runes[start:end]))
+		}
+		start = -1
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		script := scriptOf(r)
+		switch {
+		case script == "Han" || script == "Hiragana":
+			flush(i)
+			end := i
+			for end < len(runes) && (scriptOf(runes[end]) == "Han" || scriptOf(runes[end]) == "Hiragana") {
+				end++
+			}
+			words = append(words, segmentCJK(runes[i:end], japanese)...)
+			i = end - 1
+		case script == "Katakana" || r == 'ー' && start >= 0 && scriptOf(runes[start]) == "Katakana":
+			if start >= 0 && scriptOf(runes[start]) != "Katakana" {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if start >= 0 && scriptOf(runes[start]) == "Katakana" {
+				flush(i)
+			}
+			if start < 0 {
+				start = i
+			}
+		case (r == '\'' || r == '’' || r == '-') && start >= 0 && i+1 < len(runes) && unicode.IsLetter(runes[i+1]):
+		default:
+			flush(i)
+		}
+	}
+	flush(len(runes))
+
+	return words
+}
+
+// japaneseParticles end the word before them in Japanese, longest first
+var japaneseParticles = []string{"から", "まで", "より", "は", "が", "を", "に", "で", "と", "の", "も", "へ", "や"}
+
+// segmentCJK splits a run of Han and Hiragana characters into words.
+// Chinese text (no kana anywhere in the response) counts every Han
+// character as a word; Chinese words average about 1.5 characters, so this
+// overcounts them by about half. In Japanese, a Han run takes the Hiragana
+// after it (okurigana, as in 食べる) up to a particle, which is a word of
+// its own; a Hiragana run not led by Han (ありがとう, です) is one word,
+// split only before は and を. The rules err when okurigana contain a
+// particle character (確かに counts 2) and merge some words (ございます
+// after ありがとう), so counts are close to, but not those of, a
+// dictionary segmenter.
+func segmentCJK(run []rune, japanese bool) []string {
+	if !japanese {
+		words := make([]string, len(run))
+		for i, r := range run {
+			words[i] = string(r)
+		}
+		return words
+	}
+
+	var words []string
+	start, led := 0, false
+	flush := func(end int) {
+		if end > start {
+			words = append(words, string(run[start:end]))
+		}
+		start = end
+	}
+	for i := 0; i < len(run); {
+		if scriptOf(run[i]) == "Han" {
+			if i > 0 && scriptOf(run[i-1]) == "Hiragana" {
+				flush(i)
+			}
+			if i == start {
+				led = true
+			}
+			i++
+			continue
+		}
+		particle := ""
+		if i > start {
+			for _, p := range japaneseParticles {
+				if (led || p == "は" || p == "を") && strings.HasPrefix(string(run[i:]), p) {
+					particle = p
+					break
+				}
+			}
+		}
+		if particle == "" {
+			if i == start {
+				led = false
+			}
+			i++
+			continue
+		}
+		flush(i)
+		i += utf8.RuneCountInString(particle)
+		flush(i)
+		led = false
+	}
+	flush(len(run))
+	return words
+}
+
+// splitSentences splits text on sentence-ending punctuation followed by a
+// space, on the full-width terminators of Chinese and Japanese, which need
+// no space, and on line breaks, which end headings and list items.
+func splitSentences(text string) []string {
+	var sentences []string
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(strings.TrimSpace(line))
+		start := 0
+		for i, r := range runes {
+			end := i == len(runes)-1 || strings.ContainsRune("。！？", r)
+			if !end && strings.ContainsRune(".!?؟।", r) && unicode.IsSpace(runes[i+1]) {
+				end = true
+			}
+			if end {
+				if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+					sentences = append(sentences, sentence)
+				}
+				start = i + 1
+			}
+		}
+	}
+	return sentences
+}
+
+// Syllables estimates the syllables of an English word by counting vowel
+// groups, dropping a silent final "e".
+func Syllables(word string) int {
+	word = strings.ToLower(word)
+	n := 0
+	vowel := false
+	for _, r := range word {
+		isVowel := strings.ContainsRune("aeiouy", r)
+		if isVowel && !vowel {
+			n++
+		}
+		vowel = isVowel
+	}
+	if n > 1 && strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") {
+		n--
+	}
+	return max(n, 1)
+}
+
+// Flesch computes the Flesch reading ease and Flesch-Kincaid grade level of
+// English text, or returns nil when it has no words.
+func Flesch(text string) *Readability {
+	var words, syllables int
+	for _, word := range Words(text) {
+		if !strings.ContainsFunc(word, unicode.IsLetter) {
+			continue
+		}
+		words++
+		syllables += Syllables(word)
+	}
+	sentences := len(splitSentences(text))
+	if words == 0 || sentences == 0 {
+		return nil
+	}
+
+	wordsPerSentence := float64(words) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(words)
+	return &Readability{
+		FleschReadingEase:  math.Round((206.835-1.015*wordsPerSentence-84.6*syllablesPerWord)*10) / 10,
+		FleschKincaidGrade: math.Round((0.39*wordsPerSentence+11.8*syllablesPerWord-15.59)*10) / 10,
+		Syllables:          syllables,
+	}
+}
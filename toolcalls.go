@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parakeet-nest/parakeet/llm"
+)
+
+// maxToolTurns bounds the tool-call loop so a model that keeps calling tools
+// cannot run forever.
+const maxToolTurns = 6
+
+// digitGroupSeparator matches a thousands separator between two digit
+// groups: a comma, an apostrophe or a (narrow, no-break) space
+var digitGroupSeparator = regexp.MustCompile(`(\d)[,' \x{00A0}\x{202F}](\d{3})\b`)
+
+// MockTool is a local tool implementation returning canned results
+type MockTool struct {
+	Tool llm.Tool
+	Run  func(args map[string]interface{}) (interface{}, error)
+}
+
+// ExpectedToolCall is a tool call the model should make, in order
+type ExpectedToolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+}
+
+// ToolCallRecord is a tool call made by the model and the mock's reply
+type ToolCallRecord struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Result    interface{}            `json:"result,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// ToolResult holds the grading of a tool-calling test
+type ToolResult struct {
+	Calls            []ToolCallRecord `json:"calls"`
+	Turns            int              `json:"turns"`
+	SequenceMatch    bool             `json:"sequenceMatch"`
+	ArgumentAccuracy float64          `json:"argumentAccuracy"`
+	AnswerCorrect    bool             `json:"answerCorrect"`
+	Score            float64          `json:"score"`
+}
+
+// kvStore is the canned data behind the kv_lookup tool
+var kvStore = map[string]string{
+	"office:E-1042":   "Oslo",
+	"office:E-2077":   "Madrid",
+	"manager:E-1042":  "E-2077",
+	"currency:Norway": "NOK",
+}
+
+// weatherReports are the canned forecasts behind the get_weather tool
+var weatherReports = map[string]map[string]interface{}{
+	"paris":  {"temperature_c": 14, "conditions": "light rain"},
+	"oslo":   {"temperature_c": -2, "conditions": "snow"},
+	"madrid": {"temperature_c": 27, "conditions": "sunny"},
+}
+
+func functionTool(name, description string, properties map[string]llm.Property, required ...string) llm.Tool {
+	return llm.Tool{
+		Type: "function",
+		Function: llm.Function{
+			Name:        name,
+			Description: description,
+			Parameters: llm.Parameters{
+				Type:       "object",
+				Properties: properties,
+				Required:   required,
+			},
+		},
+	}
+}
+
+// MockTools lists the tools a prompt can declare
+var MockTools = map[string]MockTool{
+	"calculator": {
+		Tool: functionTool("calculator", "Perform a basic arithmetic operation on two numbers",
+			map[string]llm.Property{
+				"operation": {Type: "string", Description: "One of add, subtract, multiply, divide"},
+				"a":         {Type: "number", Description: "First operand"},
+				"b":         {Type: "number", Description: "Second operand"},
+			}, "operation", "a", "b"),
+		Run: func(args map[string]interface{}) (interface{}, error) {
+			a, okA := toFloat(args["a"])
+			b, okB := toFloat(args["b"])
+			if !okA || !okB {
+				return nil, fmt.Errorf("operands must be numbers")
+			}
+			switch fmt.Sprint(args["operation"]) {
+			case "add":
+				return a + b, nil
+			case "subtract":
+				return a - b, nil
+			case "multiply":
+				return a * b, nil
+			case "divide":
+				if b == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return a / b, nil
+			}
+			return nil, fmt.Errorf("unknown operation: %v", args["operation"])
+		},
+	},
+	"kv_lookup": {
+		Tool: functionTool("kv_lookup", "Look up the value stored under a key in the company key-value store",
+			map[string]llm.Property{
+				"key": {Type: "string", Description: "The key to look up"},
+			}, "key"),
+		Run: func(args map[string]interface{}) (interface{}, error) {
+			value, ok := kvStore[fmt.Sprint(args["key"])]
+			if !ok {
+				return nil, fmt.Errorf("key not found: %v", args["key"])
+			}
+			return value, nil
+		},
+	},
+	"get_weather": {
+		Tool: functionTool("get_weather", "Get the current weather for a city",
+			map[string]llm.Property{
+				"city": {Type: "string", Description: "Name of the city"},
+			}, "city"),
+		Run: func(args map[string]interface{}) (interface{}, error) {
+			report, ok := weatherReports[strings.ToLower(strings.TrimSpace(fmt.Sprint(args["city"])))]
+			if !ok {
+				return nil, fmt.Errorf("no weather data for %v", args["city"])
+			}
+			return report, nil
+		},
+	},
+}
+
+// RunToolChat drives the chat loop for a tool-calling prompt: every tool call
+// is answered by the matching mock until the model produces a final answer.
+func RunToolChat(url string, request ChatRequest, spec PromptSpec) (ChatResponse, *ToolResult, error) {
+	result := &ToolResult{}
+
+	for _, name := range spec.Tools {
+		mock, ok := MockTools[name]
+		if !ok {
+			return ChatResponse{}, nil, fmt.Errorf("unknown mock tool: %s", name)
+		}
+		request.Tools = append(request.Tools, mock.Tool)
+	}
+
+	var answer ChatResponse
+	for result.Turns < maxToolTurns {
+		var err error
+		answer, err = Chat(url, request)
+		if err != nil {
+			return ChatResponse{}, nil, err
+		}
+		result.Turns++
+
+		if len(answer.Message.ToolCalls) == 0 {
+			break
+		}
+
+		request.Messages = append(request.Messages, answer.Message)
+		for _, call := range answer.Message.ToolCalls {
+			record := ToolCallRecord{Name: call.Function.Name, Arguments: call.Function.Arguments}
+
+			var content string
+			if mock, ok := MockTools[call.Function.Name]; ok {
+				value, err := mock.Run(call.Function.Arguments)
+				if err != nil {
+					record.Error = err.Error()
+				} else {
+					record.Result = value
+				}
+			} else {
+				record.Error = "unknown tool: " + call.Function.Name
+			}
+
+			if record.Error != "" {
+				content = `{"error":` + strconv.Quote(record.Error) + `}`
+			} else {
+				data, _ := json.Marshal(record.Result)
+				content = string(data)
+			}
+
+			result.Calls = append(result.Calls, record)
+			request.Messages = append(request.Messages, ChatMessage{Role: "tool", Content: content})
+		}
+	}
+
+	gradeToolCalls(result, answer.Message.Content, spec)
+	return answer, result, nil
+}
+
+// gradeToolCalls compares the recorded calls and final answer with the spec
+func gradeToolCalls(result *ToolResult, finalAnswer string, spec PromptSpec) {
+	result.SequenceMatch = len(result.Calls) == len(spec.ExpectedCalls)
+	for i, want := range spec.ExpectedCalls {
+		if i >= len(result.Calls) || result.Calls[i].Name != want.Name {
+			result.SequenceMatch = false
+		}
+	}
+
+	matched, total := 0, 0
+	for i, want := range spec.ExpectedCalls {
+		for name, value := range want.Arguments {
+			total++
+			if i < len(result.Calls) && result.Calls[i].Name == want.Name && argumentEqual(value, result.Calls[i].Arguments[name]) {
+				matched++
+			}
+		}
+	}
+	if total > 0 {
+		result.ArgumentAccuracy = float64(matched) / float64(total)
+	} else if result.SequenceMatch {
+		result.ArgumentAccuracy = 1
+	}
+
+	result.AnswerCorrect = spec.ExpectedAnswer == "" || answerMentions(finalAnswer, spec.ExpectedAnswer)
+
+	score := result.ArgumentAccuracy
+	if result.SequenceMatch {
+		score++
+	}
+	if result.AnswerCorrect {
+		score++
+	}
+	result.Score = score / 3
+}
+
+// answerMentions reports whether the final answer states the expected one.
+// Digit groups are joined first, so "7,006,652" and "7 006 652" state
+// 7006652, and a number must not be part of a longer one.
+func answerMentions(answer, expected string) bool {
+	for {
+		joined := digitGroupSeparator.ReplaceAllString(answer, "$1$2")
+		if joined == answer {
+			break
+		}
+		answer = joined
+	}
+	if _, err := strconv.ParseFloat(expected, 64); err == nil {
+		return containsWord(answer, expected)
+	}
+	return strings.Contains(strings.ToLower(answer), strings.ToLower(expected))
+}
+
+// argumentEqual compares an expected argument with the model's, accepting
+// numbers sent as strings.
+func argumentEqual(want, got interface{}) bool {
+	if w, ok := toFloat(want); ok {
+		g, ok := toFloat(got)
+		return ok && w == g
+	}
+	return jsonEqual(want, got)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// printToolSummary compares tool-calling quality across configs
+func printToolSummary(results []TestResult) {
+	type totals struct {
+		runs, sequences, answers int
+		arguments, score         float64
+	}
+	byConfig := make(map[string]*totals)
+
+	for _, result := range results {
+		if result.Tools == nil {
+			continue
+		}
+		t, ok := byConfig[string(result.Config)]
+		if !ok {
+			t = &totals{}
+			byConfig[string(result.Config)] = t
+		}
+		t.runs++
+		if result.Tools.SequenceMatch {
+			t.sequences++
+		}
+		if result.Tools.AnswerCorrect {
+			t.answers++
+		}
+		t.arguments += result.Tools.ArgumentAccuracy
+		t.score += result.Tools.Score
+	}
+
+	if len(byConfig) == 0 {
+		return
+	}
+
+	fmt.Printf("\nTool calling summary:\n")
+	fmt.Printf("%-20s %6s %9s %10s %8s %7s\n", "Config", "Runs", "Sequence", "Arguments", "Answer", "Score")
+	for _, config := range sortedKeys(byConfig) {
+		t := byConfig[config]
+		n := float64(t.runs)
+		fmt.Printf("%-20s %6d %8.0f%% %9.0f%% %7.0f%% %6.2f\n",
+			config, t.runs, 100*float64(t.sequences)/n, 100*t.arguments/n, 100*float64(t.answers)/n, t.score/n)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// LoadImages reads local image files and encodes them for the images field
+// of a generate request.
+func LoadImages(paths []string) ([]string, error) {
+	images := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image: %v", err)
+		}
+		images = append(images, base64.StdEncoding.EncodeToString(data))
+	}
+	return images, nil
+}